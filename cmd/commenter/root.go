@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/operator-framework/flak-analyzer/pkg/artifacts/commenter"
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+	"github.com/operator-framework/flak-analyzer/pkg/github"
 )
 
 var rootCmd = &cobra.Command{
@@ -18,6 +29,21 @@ var rootCmd = &cobra.Command{
 		owner := cmd.Flag("owner").Value.String()
 		repo := cmd.Flag("repo").Value.String()
 		token := cmd.Flag("token").Value.String()
+		var repos []commenter.RepoEntry
+		if path := cmd.Flag("repos-config").Value.String(); path != "" {
+			config, err := commenter.LoadReposConfig(path)
+			if err != nil {
+				return err
+			}
+			repos = config.Repos
+		}
+		if (owner == "" || repo == "") && len(repos) == 0 {
+			return fmt.Errorf("commenting requires the `owner` and `repo` of a repository, or a `repos-config`")
+		}
+		concurrency, err := strconv.Atoi(cmd.Flag("concurrency").Value.String())
+		if err != nil {
+			return err
+		}
 
 		local_owner := cmd.Flag("local-owner").Value.String()
 		local_repo := cmd.Flag("local-repo").Value.String()
@@ -29,59 +55,443 @@ var rootCmd = &cobra.Command{
 		testNameFilter := cmd.Flag("test-suite-filter").Value.String()
 		artifactName := cmd.Flag("artifact-name").Value.String()
 		progressFile := cmd.Flag("progress-file-dir").Value.String()
+		commentMode, err := reporter.ParseCommentMode(cmd.Flag("comment-mode").Value.String())
+		if err != nil {
+			return err
+		}
+		commentHistory, err := strconv.Atoi(cmd.Flag("comment-history").Value.String())
+		if err != nil {
+			return err
+		}
+		comment, err := strconv.ParseBool(cmd.Flag("comment").Value.String())
+		if err != nil {
+			return err
+		}
+		checkRun, err := strconv.ParseBool(cmd.Flag("check-run").Value.String())
+		if err != nil {
+			return err
+		}
+		baselineBranch := cmd.Flag("baseline-branch").Value.String()
+		baselineDays, err := strconv.Atoi(cmd.Flag("baseline-days").Value.String())
+		if err != nil {
+			return err
+		}
+		rerunBudget, err := strconv.Atoi(cmd.Flag("rerun-budget").Value.String())
+		if err != nil {
+			return err
+		}
+		if rerunBudget < 0 {
+			return fmt.Errorf("the rerun budget must not be negative, got %d", rerunBudget)
+		}
+		if rerunBudget > 0 && baselineBranch == "" {
+			return fmt.Errorf("re-running known flakes requires a baseline branch to know the flakes from")
+		}
+		labelPRs, err := strconv.ParseBool(cmd.Flag("label-prs").Value.String())
+		if err != nil {
+			return err
+		}
+		if labelPRs && baselineBranch == "" {
+			return fmt.Errorf("labeling pull requests requires a baseline branch to classify failures against")
+		}
+		commentTemplate, err := reporter.LoadTemplate(cmd.Flag("comment-template").Value.String())
+		if err != nil {
+			return err
+		}
+		slashCommands, err := strconv.ParseBool(cmd.Flag("slash-commands").Value.String())
+		if err != nil {
+			return err
+		}
+		watch, err := strconv.ParseBool(cmd.Flag("watch").Value.String())
+		if err != nil {
+			return err
+		}
+		interval, err := time.ParseDuration(cmd.Flag("interval").Value.String())
+		if err != nil {
+			return err
+		}
+		if watch && interval <= 0 {
+			return fmt.Errorf("the poll interval must be positive, got %s", interval)
+		}
+		quiet := commenter.QuietPolicy{}
+		if quiet.WaitForRuns, err = strconv.ParseBool(cmd.Flag("wait-for-runs").Value.String()); err != nil {
+			return err
+		}
+		if quiet.MinInterval, err = time.ParseDuration(cmd.Flag("min-report-interval").Value.String()); err != nil {
+			return err
+		}
+		if quiet.SkipDrafts, err = strconv.ParseBool(cmd.Flag("skip-drafts").Value.String()); err != nil {
+			return err
+		}
+		if quiet.OptOutLabels, err = cmd.Flags().GetStringSlice("opt-out-labels"); err != nil {
+			return err
+		}
+		if quiet.MaxPRs, err = strconv.Atoi(cmd.Flag("max-prs-per-run").Value.String()); err != nil {
+			return err
+		}
+		if quiet.MinInterval < 0 || quiet.MaxPRs < 0 {
+			return fmt.Errorf("the minimum report interval and the maximum pull requests per run must not be negative")
+		}
+		prSummary, err := strconv.ParseBool(cmd.Flag("pr-summary").Value.String())
+		if err != nil {
+			return err
+		}
+		retention, err := time.ParseDuration(cmd.Flag("closed-pr-retention").Value.String())
+		if err != nil {
+			return err
+		}
+		if retention < 0 {
+			return fmt.Errorf("the closed pull request retention must not be negative, got %s", retention)
+		}
+		healthAddr := cmd.Flag("health-addr").Value.String()
+		webhookAddr := cmd.Flag("webhook-addr").Value.String()
+		webhookSecret := cmd.Flag("webhook-secret").Value.String()
+		if webhookSecret == "" {
+			webhookSecret = os.Getenv("WEBHOOK_SECRET")
+		}
+		webhookConcurrency, err := strconv.Atoi(cmd.Flag("webhook-concurrency").Value.String())
+		if err != nil {
+			return err
+		}
+		if webhookAddr != "" && watch {
+			return fmt.Errorf("the commenter either watches or serves webhooks, not both")
+		}
+		if webhookAddr != "" && webhookSecret == "" {
+			return fmt.Errorf("serving webhooks requires the `webhook-secret` to validate their signature")
+		}
+		dryRun, err := strconv.ParseBool(cmd.Flag("dry-run").Value.String())
+		if err != nil {
+			return err
+		}
+		dryRunDir := cmd.Flag("dry-run-dir").Value.String()
+		if dryRunDir != "" && !dryRun {
+			return fmt.Errorf("the `dry-run-dir` is only written on a `dry-run`")
+		}
+		cacheDir := cmd.Flag("cache-dir").Value.String()
+		githubURL := cmd.Flag("github-url").Value.String()
+		uploadURL := cmd.Flag("upload-url").Value.String()
+		appID, err := strconv.ParseInt(cmd.Flag("app-id").Value.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		appPrivateKey := cmd.Flag("app-private-key").Value.String()
+		tokenDir := cmd.Flag("token-dir").Value.String()
+		netrcFile := cmd.Flag("netrc").Value.String()
+		credentialHelper := cmd.Flag("credential-helper").Value.String()
 
-		cf, err := commenter.NewCommenter(local_owner, local_repo, local_token, artifactName, progressFile)
+		options := []github.ClientOption{
+			github.WithCredentials(github.NewCredentialChain(tokenDir, netrcFile, credentialHelper)),
+		}
+		if cacheDir != "" {
+			options = append(options, github.WithHTTPCache(cacheDir))
+		}
+		if githubURL != "" {
+			options = append(options, github.WithEnterpriseURLs(githubURL, uploadURL))
+		}
+		if appID != 0 {
+			key, err := ioutil.ReadFile(appPrivateKey)
+			if err != nil {
+				return fmt.Errorf("failed to read GitHub App private key, %v", err)
+			}
+			options = append(options, github.WithAppAuth(appID, key))
+		}
+		if dryRun {
+			options = append(options, github.WithDryRun(github.NewDryRun(os.Stdout, dryRunDir)))
+		}
+
+		localClient, err := github.NewRepositoryClient(context.Background(), local_token, local_owner, local_repo,
+			false, options...)
+		if err != nil {
+			return err
+		}
+		store, err := progressStore(cmd, localClient, artifactName, progressFile)
 		if err != nil {
 			return err
 		}
-		err = cf.AddRepo(owner, repo, token, testNameFilter)
+		cf, err := commenter.NewCommenterWithStore(local_owner, local_repo, local_token, store, options...)
 		if err != nil {
 			return err
 		}
+		defer cf.Close()
+		cf.SetCommentMode(commentMode, commentHistory)
+		cf.SetCommentTemplate(commentTemplate)
+		cf.SetPublishing(comment, checkRun)
+		cf.SetBaseline(baselineBranch, baselineDays)
+		cf.SetRerunBudget(rerunBudget)
+		cf.SetRetention(retention)
+		cf.SetQuietPolicy(quiet)
+		cf.SetPRSummaries(prSummary, cmd.Flag("pr-summary-dir").Value.String())
+		cf.SetSlashCommands(slashCommands)
+		cf.SetConcurrency(concurrency)
+		if labelPRs {
+			cf.SetPRLabels(&commenter.PRLabels{
+				Flaky:       cmd.Flag("flaky-label").Value.String(),
+				Broken:      cmd.Flag("broken-label").Value.String(),
+				Investigate: cmd.Flag("investigate-label").Value.String(),
+			})
+		}
+		if owner != "" && repo != "" {
+			repos = append([]commenter.RepoEntry{{Owner: owner, Repo: repo, Suites: []string{testNameFilter}}},
+				repos...)
+		}
+		// A repository that cannot be added is left out, so that the others are still commented on.
+		var failed []commenter.RepoResult
+		for _, r := range repos {
+			repoToken, err := r.Token()
+			if err == nil {
+				if repoToken == "" {
+					repoToken = token
+				}
+				err = cf.AddRepoSuites(r.Owner, r.Repo, repoToken, r.Suites)
+			}
+			if err != nil {
+				log.Errorf("Failed to add %s/%s, %v", r.Owner, r.Repo, err)
+				failed = append(failed, commenter.RepoResult{Owner: r.Owner, Repo: r.Repo, Err: err})
+			}
+		}
+		if len(failed) == len(repos) {
+			return fmt.Errorf("failed to add any repository to comment on")
+		}
+		if watch {
+			return watchComments(cf, interval, healthAddr)
+		}
+		if webhookAddr != "" {
+			return serveWebhooks(cf, webhookAddr, []byte(webhookSecret), webhookConcurrency)
+		}
 		_, err = cf.GenerateComments()
+		results := append(failed, cf.Results()...)
+		logSummary(results)
 		if err != nil {
 			return err
 		}
-
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to comment on %d of %d repositories", len(failed), len(results))
+		}
 		return nil
 	},
 }
 
-func main() {
-	rootCmd.Flags().StringP("owner", "n", "", "The owner of the repository to analyze the flakes.")
-	if err := rootCmd.MarkFlagRequired("owner"); err != nil {
-		log.Fatalf("Failed to mark `owner` flag for `flake-analyzer` subcommand as required")
+// logSummary logs the outcome of commenting on each repository.
+func logSummary(results []commenter.RepoResult) {
+	for _, r := range results {
+		if r.Err != nil {
+			log.Errorf("%s/%s: failed, %v", r.Owner, r.Repo, r.Err)
+			continue
+		}
+		log.Infof("%s/%s: %d test suites, %d open pull requests, %d reported on, %d comments posted,"+
+			" %d merged or closed pull requests summarized, %d held back", r.Owner, r.Repo, r.Suites, r.PullRequests,
+			r.Reported, r.Comments, r.Summarized, r.HeldBack)
 	}
+}
 
-	rootCmd.Flags().StringP("repo", "r", "", "The name of the repository for analyze the flakes.")
-	if err := rootCmd.MarkFlagRequired("repo"); err != nil {
-		log.Fatalf("Failed to mark `repo` flag for `flake-analyzer` subcommand as required")
+// terminated returns a context canceled on SIGTERM or interrupt.
+func terminated(action string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case s := <-signals:
+			log.Infof("Received %s, %s", s, action)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// serveWebhooks reports on pull requests as webhooks are received on addr at /webhook, until the commenter is
+// terminated. Reports in progress are completed first.
+func serveWebhooks(cf *commenter.CommenterFile, addr string, secret []byte, concurrency int) error {
+	ctx, cancel := terminated("stopping after the reports in progress")
+	defer cancel()
+
+	handler := cf.WebhookHandler(secret, concurrency)
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", handler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	log.Infof("Serving webhooks on %s/webhook", addr)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve webhooks, %v", err)
+	case <-ctx.Done():
 	}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	err := server.Shutdown(shutdownCtx)
+	handler.Wait()
+	return err
+}
 
-	rootCmd.Flags().StringP("token", "t", "", "The personal access token for the repository to interact with the stored artifacts")
-	if err := rootCmd.MarkFlagRequired("token"); err != nil {
-		log.Fatalf("Failed to mark `token` flag for `flake-analyzer` subcommand as required")
+// watchComments polls for new runs every interval and serves the health of the commenter on healthAddr, until the
+// commenter is terminated.
+func watchComments(cf *commenter.CommenterFile, interval time.Duration, healthAddr string) error {
+	ctx, cancel := terminated("stopping after the current poll")
+	defer cancel()
+
+	if healthAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", cf.HealthHandler())
+		server := &http.Server{Addr: healthAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Failed to serve the health endpoint, %v", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+		log.Infof("Serving health on %s/healthz", healthAddr)
 	}
+	return cf.Watch(ctx, interval)
+}
 
-	rootCmd.Flags().StringP("local-owner", "m", "operator-framework",
-		"The owner of the repository hosting the analyzer.")
-	if err := rootCmd.MarkFlagRequired("owner"); err != nil {
-		log.Fatalf("Failed to mark `local-owner` flag for `flake-analyzer` subcommand as required")
+// progressStore returns the progress store selected by the `progress-store` flag.
+func progressStore(cmd *cobra.Command, client *github.RepositoryClient, artifactName, progressFile string) (
+	commenter.ProgressStore, error) {
+	switch kind := cmd.Flag("progress-store").Value.String(); kind {
+	case "artifact":
+		return commenter.NewArtifactStore(client, artifactName, progressFile), nil
+	case "file":
+		if progressFile == "" {
+			progressFile = "./commenter_progress_file.yaml"
+		}
+		return commenter.NewFileStore(progressFile), nil
+	case "branch":
+		return commenter.NewBranchStore(client, cmd.Flag("progress-branch").Value.String(), progressFile), nil
+	case "issue":
+		number, err := strconv.Atoi(cmd.Flag("progress-issue").Value.String())
+		if err != nil {
+			return nil, err
+		}
+		if number <= 0 {
+			return nil, fmt.Errorf("the issue progress store requires the `progress-issue` number")
+		}
+		return commenter.NewIssueStore(client, number), nil
+	case "gist":
+		id := cmd.Flag("progress-gist").Value.String()
+		if id == "" {
+			return nil, fmt.Errorf("the gist progress store requires the `progress-gist` ID")
+		}
+		return commenter.NewGistStore(client, id, progressFile), nil
+	default:
+		return nil, fmt.Errorf("unknown progress store %q, must be one of artifact, file, branch, issue or gist", kind)
 	}
+}
 
-	rootCmd.Flags().StringP("local-repo", "l", "flake-analyzer", "The name of the repository hosting the analyzer.")
-	if err := rootCmd.MarkFlagRequired("repo"); err != nil {
-		log.Fatalf("Failed to mark `local-repo` flag for `flake-analyzer` subcommand as required")
+func defaultNetrcFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(home, ".netrc")
+}
 
+func main() {
+	rootCmd.Flags().StringP("owner", "n", "", "The owner of the repository to analyze the flakes.")
+	rootCmd.Flags().StringP("repo", "r", "", "The name of the repository for analyze the flakes.")
+	rootCmd.Flags().String("repos-config", "",
+		"The YAML file listing the repositories to comment on, with their test suites and tokens, in addition to"+
+			" `owner` and `repo`.")
+	rootCmd.Flags().Int("concurrency", 4, "The number of repositories commented on at a time.")
+
+	rootCmd.Flags().StringP("token", "t", "", "The personal access token for the repository to interact with the stored artifacts")
+	rootCmd.Flags().Int64("app-id", 0, "The ID of the GitHub App to authenticate as instead of using a token.")
+	rootCmd.Flags().String("app-private-key", "", "The path to the PEM encoded private key of the GitHub App.")
+	rootCmd.Flags().String("token-dir", "",
+		"The directory holding token files named <owner>/<repo>, <owner>/default or default, used when no token is given.")
+	rootCmd.Flags().String("netrc", defaultNetrcFile(), "The netrc file to look up tokens in when no token is given.")
+	rootCmd.Flags().String("credential-helper", "",
+		"The git credential helper to ask for tokens when no token is given, e.g. \"gh auth git-credential\".")
+
+	rootCmd.Flags().StringP("local-owner", "m", "operator-framework",
+		"The owner of the repository hosting the analyzer.")
+	rootCmd.Flags().StringP("local-repo", "l", "flake-analyzer", "The name of the repository hosting the analyzer.")
 	rootCmd.Flags().StringP("local-token", "a", "",
 		"The personal access token for the repository hosting the analyzer (default to `token` value).")
 
 	rootCmd.Flags().StringP("test-suite-filter", "f", "",
-		"Filter test by the test suite name or the common names between the artifacts.")
+		"Filter test by the test suite name or the common names between the artifacts. The suites of the analyzed"+
+			" repository's .github/flake-analyzer.yaml take precedence.")
 
-	rootCmd.Flags().StringP("progress-file-dir", "p", "", "The directory to save the generated report.")
+	rootCmd.Flags().StringP("progress-file-dir", "p", "",
+		"The file to save the progress to, or its path on the `progress-branch` or in the `progress-gist`.")
 	rootCmd.Flags().StringP("artifact-name", "i", "flake-bot-progress", "The name of the artifact to save progress.")
+	rootCmd.Flags().String("progress-store", "artifact",
+		"Where to keep the progress: in an \"artifact\" uploaded by the workflow, a local \"file\", a file on a"+
+			" \"branch\" of the analyzer repository, or the body of an \"issue\" or \"gist\".")
+	rootCmd.Flags().String("progress-branch", "flake-analyzer-progress",
+		"The branch of the analyzer repository to commit the progress to, created if necessary.")
+	rootCmd.Flags().Int("progress-issue", 0, "The number of the analyzer repository issue to keep the progress in.")
+	rootCmd.Flags().String("progress-gist", "", "The ID of the gist to keep the progress in.")
+	rootCmd.Flags().String("comment-mode", string(reporter.CommentUpdate),
+		"How to handle the previous report comment: \"update\" it in place, post a new one and \"minimize\" the"+
+			" previous ones as outdated, or always post a \"new\" one.")
+	rootCmd.Flags().Int("comment-history", 0,
+		"The number of previous reports to keep collapsed in the report comment when updating it in place.")
+	rootCmd.Flags().String("comment-template", reporter.TemplateDetailed,
+		"The text/template file to render pull request comments with, or one of the built-in templates \"detailed\","+
+			" \"compact\" or \"minimal\".")
+	rootCmd.Flags().Bool("comment", true, "Post the pull request report as a comment.")
+	rootCmd.Flags().Bool("check-run", false,
+		"Publish the pull request report as a check run with annotations on the head commit. Requires GitHub App credentials.")
+	rootCmd.Flags().String("baseline-branch", "",
+		"Classify pull request failures as known flakes, known tests with new errors or new failures against this branch, e.g. \"master\".")
+	rootCmd.Flags().Int("baseline-days", 7, "The number of days of `baseline-branch` history to classify failures against.")
+	rootCmd.Flags().Int("rerun-budget", 0,
+		"Re-run the failed jobs of pull request runs whose failed tests are all known flakes of `baseline-branch`, at most this number of times per pull request.")
+	rootCmd.Flags().Duration("closed-pr-retention", commenter.DefaultRetention,
+		"How long the runs of closed pull requests are kept in the progress, so that reopened pull requests are not reported on again.")
+	rootCmd.Flags().Bool("pr-summary", false,
+		"Comment a summary of the runs, failed runs, flaky tests and CI minutes spent on failures when a pull request is merged or closed.")
+	rootCmd.Flags().String("pr-summary-dir", "",
+		"The directory to write the summaries of merged and closed pull requests to as YAML, e.g. to upload with the reports.")
+	quiet := commenter.DefaultQuietPolicy()
+	rootCmd.Flags().Bool("wait-for-runs", quiet.WaitForRuns,
+		"Wait until all workflow runs on the head commit of a pull request completed before reporting on it.")
+	rootCmd.Flags().Duration("min-report-interval", quiet.MinInterval,
+		"The minimum time between two report comments on a pull request. Runs completed meanwhile are reported on together.")
+	rootCmd.Flags().Bool("skip-drafts", quiet.SkipDrafts, "Do not report on draft pull requests until they are ready for review.")
+	rootCmd.Flags().StringSlice("opt-out-labels", quiet.OptOutLabels, "Do not report on pull requests with any of these labels.")
+	rootCmd.Flags().Int("max-prs-per-run", quiet.MaxPRs,
+		"The number of pull requests with failed runs reported on per poll at most, 0 for no limit. The others are reported on by the next polls.")
+	labels := commenter.DefaultPRLabels()
+	rootCmd.Flags().Bool("label-prs", false,
+		"Label pull requests according to the classification of the failures on their head commit against `baseline-branch`.")
+	rootCmd.Flags().String("flaky-label", labels.Flaky, "The pull request label for failures that are all known flakes.")
+	rootCmd.Flags().String("broken-label", labels.Broken,
+		"The pull request label for runs that failed without failed tests, e.g. on build errors.")
+	rootCmd.Flags().String("investigate-label", labels.Investigate,
+		"The pull request label for new failures and tests failing with new errors.")
+	rootCmd.Flags().Bool("slash-commands", false,
+		"Run the /flake report, explain, rerun and mute commands posted in pull request comments by collaborators with write access.")
+	rootCmd.Flags().Bool("watch", false,
+		"Keep running and poll for new runs every `interval`, instead of polling once. Stops after the current poll on SIGTERM.")
+	rootCmd.Flags().Duration("interval", 2*time.Minute, "The time between polls when watching.")
+	rootCmd.Flags().String("health-addr", ":8080",
+		"The address to serve the health of the commenter on at /healthz when watching, empty to disable it.")
+	rootCmd.Flags().String("webhook-addr", "",
+		"Serve GitHub webhooks on this address at /webhook and report on pull requests as their workflow runs complete or"+
+			" commits are pushed, instead of polling.")
+	rootCmd.Flags().String("webhook-secret", "",
+		"The secret webhook signatures are validated with (default to the WEBHOOK_SECRET environment variable).")
+	rootCmd.Flags().Int("webhook-concurrency", 4, "The number of pull requests reported on at a time when serving webhooks.")
+	rootCmd.Flags().Bool("dry-run", false,
+		"Report on pull requests without changing anything: write the comments, labels and reruns that would be made to stdout or `dry-run-dir`, and leave the progress untouched.")
+	rootCmd.Flags().String("dry-run-dir", "", "The directory to write the changes of a dry run to, one file each, instead of stdout.")
+	rootCmd.Flags().String("cache-dir", "",
+		"The directory to cache GitHub API responses in. Cached responses are revalidated with conditional requests.")
+	rootCmd.Flags().String("github-url", "",
+		"The base URL of a GitHub Enterprise Server instance, e.g. https://github.example.com/api/v3/.")
+	rootCmd.Flags().String("upload-url", "",
+		"The upload URL of a GitHub Enterprise Server instance (default to `github-url` value).")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
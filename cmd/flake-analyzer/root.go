@@ -1,13 +1,18 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"text/template"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+	"github.com/operator-framework/flak-analyzer/pkg/github"
 )
 
 var rootCmd = &cobra.Command{
@@ -37,19 +42,110 @@ var rootCmd = &cobra.Command{
 		ArtifactDir := cmd.Flag("download-dir").Value.String()
 
 		PRnum := cmd.Flag("pull-request").Value.String()
+		commentMode, err := reporter.ParseCommentMode(cmd.Flag("comment-mode").Value.String())
+		if err != nil {
+			return err
+		}
+		commentHistory, err := strconv.Atoi(cmd.Flag("comment-history").Value.String())
+		if err != nil {
+			return err
+		}
+		comment, err := strconv.ParseBool(cmd.Flag("comment").Value.String())
+		if err != nil {
+			return err
+		}
+		checkRun, err := strconv.ParseBool(cmd.Flag("check-run").Value.String())
+		if err != nil {
+			return err
+		}
+		baselineBranch := cmd.Flag("baseline-branch").Value.String()
+		baselineDays, err := strconv.Atoi(cmd.Flag("baseline-days").Value.String())
+		if err != nil {
+			return err
+		}
+		issues, err := strconv.ParseBool(cmd.Flag("issues").Value.String())
+		if err != nil {
+			return err
+		}
+		issueThreshold, err := strconv.Atoi(cmd.Flag("issue-threshold").Value.String())
+		if err != nil {
+			return err
+		}
+		issueCloseAfter, err := strconv.Atoi(cmd.Flag("issue-close-after").Value.String())
+		if err != nil {
+			return err
+		}
+		issueLabels, err := cmd.Flags().GetStringSlice("issue-labels")
+		if err != nil {
+			return err
+		}
+		issueResolvedLabel := cmd.Flag("issue-resolved-label").Value.String()
+		commentTemplate, err := reporter.LoadTemplate(cmd.Flag("comment-template").Value.String())
+		if err != nil {
+			return err
+		}
+		var reportTemplate *template.Template
+		if name := cmd.Flag("report-template").Value.String(); name != "" {
+			if reportTemplate, err = reporter.LoadTemplate(name); err != nil {
+				return err
+			}
+		}
+		dryRun, err := strconv.ParseBool(cmd.Flag("dry-run").Value.String())
+		if err != nil {
+			return err
+		}
+		dryRunDir := cmd.Flag("dry-run-dir").Value.String()
+		if dryRunDir != "" && !dryRun {
+			return fmt.Errorf("the `dry-run-dir` is only written on a `dry-run`")
+		}
+		cacheDir := cmd.Flag("cache-dir").Value.String()
+		githubURL := cmd.Flag("github-url").Value.String()
+		uploadURL := cmd.Flag("upload-url").Value.String()
+		appID, err := strconv.ParseInt(cmd.Flag("app-id").Value.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		appPrivateKey := cmd.Flag("app-private-key").Value.String()
+		tokenDir := cmd.Flag("token-dir").Value.String()
+		netrcFile := cmd.Flag("netrc").Value.String()
+		credentialHelper := cmd.Flag("credential-helper").Value.String()
 		waitForQuotaReset := cmd.Flag("wait-for-quota-reset").Value.String()
 		waitForReset, err := strconv.ParseBool(waitForQuotaReset)
 		if err != nil {
 			return err
 		}
 
+		// Public repositories can be analyzed without credentials.
+		options := []github.ClientOption{
+			github.WithCredentials(github.NewCredentialChain(tokenDir, netrcFile, credentialHelper)),
+			github.WithAnonymousFallback(),
+		}
+		if cacheDir != "" {
+			options = append(options, github.WithHTTPCache(cacheDir))
+		}
+		if githubURL != "" {
+			options = append(options, github.WithEnterpriseURLs(githubURL, uploadURL))
+		}
+		if appID != 0 {
+			key, err := ioutil.ReadFile(appPrivateKey)
+			if err != nil {
+				return fmt.Errorf("failed to read GitHub App private key, %v", err)
+			}
+			options = append(options, github.WithAppAuth(appID, key))
+		}
+		if dryRun {
+			options = append(options, github.WithDryRun(github.NewDryRun(os.Stdout, dryRunDir)))
+		}
+
 		report := reporter.NewFlakeReport()
 
 		if err := report.LoadReport(reporter.RepositoryInfo(owner, repo), reporter.WithToken(token),
 			reporter.FilterFromDaysAgo(fdays), reporter.FilterToDaysAgo(tdays),
 			reporter.FilterTestSuite(nameFilter), reporter.FilterCommit(commitFilter),
 			reporter.WithTempDownloadDir(ArtifactDir), reporter.WaitWaitForQuotaReset(waitForReset),
-			reporter.FilterPR(PRnum)); err != nil {
+			reporter.FilterPR(PRnum), reporter.WithReportTemplate(reportTemplate),
+			reporter.WithReportURL(cmd.Flag("report-url").Value.String()),
+			reporter.WithClientOptions(options...)); err != nil {
 			return err
 		}
 
@@ -57,8 +153,26 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		if PRnum != "" {
-			_, err := report.PostReportAsPullRequestComment()
+		if issues {
+			if _, err := report.SyncIssues(reporter.IssuePolicy{Threshold: issueThreshold,
+				CloseAfterDays: issueCloseAfter, Labels: issueLabels, ResolvedLabel: issueResolvedLabel}); err != nil {
+				return err
+			}
+		}
+
+		if PRnum != "" && baselineBranch != "" {
+			if err := report.CompareWithBranch(baselineBranch, baselineDays); err != nil {
+				return err
+			}
+		}
+		if PRnum != "" && checkRun {
+			if _, err := report.PublishCheckRun(); err != nil {
+				return err
+			}
+		}
+		if PRnum != "" && comment {
+			_, err := report.PostReportAsPullRequestComment(reporter.WithCommentMode(commentMode),
+				reporter.WithCommentHistory(commentHistory), reporter.WithCommentTemplate(commentTemplate))
 			if err != nil {
 				return err
 			}
@@ -67,6 +181,14 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+func defaultNetrcFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
 func main() {
 	rootCmd.Flags().StringP("owner", "n", "", "The owner of the repository to analyze the flakes.")
 	if err := rootCmd.MarkFlagRequired("owner"); err != nil {
@@ -78,10 +200,14 @@ func main() {
 		log.Fatalf("Failed to mark `repo` flag for `flake-analyzer` subcommand as required")
 	}
 
-	rootCmd.Flags().StringP("token", "t", "", "The personal access token for the repository to interact with the stored artifacts")
-	if err := rootCmd.MarkFlagRequired("token"); err != nil {
-		log.Fatalf("Failed to mark `token` flag for `flake-analyzer` subcommand as required")
-	}
+	rootCmd.Flags().StringP("token", "t", "", "The personal access token for the repository to interact with the stored artifacts. Public repositories are read unauthenticated when no token or credentials are found.")
+	rootCmd.Flags().Int64("app-id", 0, "The ID of the GitHub App to authenticate as instead of using a token.")
+	rootCmd.Flags().String("app-private-key", "", "The path to the PEM encoded private key of the GitHub App.")
+	rootCmd.Flags().String("token-dir", "",
+		"The directory holding token files named <owner>/<repo>, <owner>/default or default, used when no token is given.")
+	rootCmd.Flags().String("netrc", defaultNetrcFile(), "The netrc file to look up tokens in when no token is given.")
+	rootCmd.Flags().String("credential-helper", "",
+		"The git credential helper to ask for tokens when no token is given, e.g. \"gh auth git-credential\".")
 
 	rootCmd.Flags().Uint("from", 90, "Include test results created as artifacts from a number of days ago")
 	rootCmd.Flags().Uint("to", 0, "Include test results created as artifacts until a number of days ago")
@@ -95,7 +221,43 @@ func main() {
 	rootCmd.Flags().StringP("download-dir", "d", "", "The directory to save the downloaded artifacts.")
 
 	rootCmd.Flags().StringP("pull-request", "p", "", "Generate a report for a Pull Request and post as comment.")
+	rootCmd.Flags().String("comment-mode", string(reporter.CommentUpdate),
+		"How to handle the previous report comment: \"update\" it in place, post a new one and \"minimize\" the"+
+			" previous ones as outdated, or always post a \"new\" one.")
+	rootCmd.Flags().Int("comment-history", 0,
+		"The number of previous reports to keep collapsed in the report comment when updating it in place.")
+	rootCmd.Flags().String("comment-template", reporter.TemplateDetailed,
+		"The text/template file to render the pull request comment with, or one of the built-in templates \"detailed\","+
+			" \"compact\" or \"minimal\".")
+	rootCmd.Flags().String("report-template", "",
+		"The text/template file or built-in template to render the report file with instead of writing it as YAML.")
+	rootCmd.Flags().String("report-url", reporter.ActionsRunURL(),
+		"The URL of the full report, linked from comments that are too long to post in full (default to the GitHub Actions run).")
+	rootCmd.Flags().Bool("comment", true, "Post the pull request report as a comment.")
+	rootCmd.Flags().Bool("check-run", false,
+		"Publish the pull request report as a check run with annotations on the head commit. Requires GitHub App credentials.")
+	rootCmd.Flags().String("baseline-branch", "",
+		"Classify pull request failures as known flakes, known tests with new errors or new failures against this branch, e.g. \"master\".")
+	rootCmd.Flags().Int("baseline-days", 7, "The number of days of `baseline-branch` history to classify failures against.")
+	rootCmd.Flags().Bool("issues", false,
+		"Open an issue per flaky test of the report, keep it up to date and resolve it once the test stops failing.")
+	rootCmd.Flags().Int("issue-threshold", 3, "The number of failures from which an issue is opened for a flaky test.")
+	rootCmd.Flags().Int("issue-close-after", 14,
+		"Resolve the issue of a flaky test that has not failed for this number of days, 0 to never resolve issues.")
+	rootCmd.Flags().StringSlice("issue-labels", []string{"flaky-test"},
+		"The labels of flaky test issues. Only issues carrying all of them are managed.")
+	rootCmd.Flags().String("issue-resolved-label", "",
+		"Label resolved issues with this label instead of closing them.")
 	rootCmd.Flags().BoolP("wait-for-quota-reset", "w", false, "Wait for GitHub to reset token limit if quota runs out.")
+	rootCmd.Flags().Bool("dry-run", false,
+		"Generate the report without changing anything on GitHub: write the comments, check runs and issues that would be made to stdout or `dry-run-dir`.")
+	rootCmd.Flags().String("dry-run-dir", "", "The directory to write the changes of a dry run to, one file each, instead of stdout.")
+	rootCmd.Flags().String("cache-dir", "",
+		"The directory to cache GitHub API responses in. Cached responses are revalidated with conditional requests.")
+	rootCmd.Flags().String("github-url", "",
+		"The base URL of a GitHub Enterprise Server instance, e.g. https://github.example.com/api/v3/.")
+	rootCmd.Flags().String("upload-url", "",
+		"The upload URL of a GitHub Enterprise Server instance (default to `github-url` value).")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
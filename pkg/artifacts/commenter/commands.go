@@ -0,0 +1,242 @@
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+// commandLine matches slash commands, e.g. "/flake explain TestFoo", on a line of their own.
+var commandLine = regexp.MustCompile(`(?m)^/flake[ \t]+(\S+)(?:[ \t]+(\S.*?))?[ \t]*\r?$`)
+
+const commandUsage = "Use `/flake report` to post a fresh report, `/flake explain <test>` to show the failures of a" +
+	" test, `/flake rerun` to re-run failed runs whose failures are all known flakes and `/flake mute <test>` to" +
+	" propose ignoring a test."
+
+type command struct {
+	line, name, arg string
+}
+
+func parseCommands(body string) []command {
+	var commands []command
+	for _, match := range commandLine.FindAllStringSubmatch(body, -1) {
+		commands = append(commands, command{line: strings.TrimSpace(match[0]), name: match[1], arg: match[2]})
+	}
+	return commands
+}
+
+// SetSlashCommands lets collaborators with write access interact with the commenter through slash commands in pull
+// request comments, see commandUsage. Only comments posted after the commands are first enabled are considered.
+// Commands are run once per pull request, whatever the number of test suites of its repository.
+func (f *CommenterFile) SetSlashCommands(enabled bool) {
+	f.commands = enabled
+}
+
+// suitePR is an open pull request as seen by one of the test suites of its repository.
+type suitePR struct {
+	c   *Commenter
+	prc pullRequest
+}
+
+// commandCursor returns the commenter keeping the slash command cursor shared by the test suites of a repository, the
+// first of them in the progress. The cursors kept by each suite in earlier progress are merged into it. f.mu must be
+// held.
+func (f *CommenterFile) commandCursor(owner, repo string) *Commenter {
+	var cursor *Commenter
+	for _, c := range f.Commented {
+		if !strings.EqualFold(c.Owner, owner) || !strings.EqualFold(c.Repo, repo) {
+			continue
+		}
+		if cursor == nil {
+			cursor = c
+			continue
+		}
+		// Comments scanned by any of the suites were replied to already.
+		if c.CommandsSince != nil && (cursor.CommandsSince == nil || c.CommandsSince.Before(*cursor.CommandsSince)) {
+			cursor.CommandsSince = c.CommandsSince
+		}
+		for pr, id := range c.Commands {
+			if cursor.Commands == nil {
+				cursor.Commands = map[string]int64{}
+			}
+			if id > cursor.Commands[pr] {
+				cursor.Commands[pr] = id
+			}
+		}
+		c.Commands, c.CommandsSince = nil, nil
+	}
+	return cursor
+}
+
+// pruneCommands forgets the slash command cursors of the pull requests no longer open.
+func (c *Commenter) pruneCommands(open map[int][]suitePR) {
+	for key := range c.Commands {
+		if pr, err := strconv.Atoi(key); err != nil || open[pr] == nil {
+			delete(c.Commands, key)
+		}
+	}
+}
+
+// handleCommands runs the slash commands of the comments posted on a pull request since the last scan, and replies
+// to each of them. suites holds the pull request as seen by each test suite of its repository.
+func (f *CommenterFile) handleCommands(ctx context.Context, suites []suitePR) error {
+	c, prc := suites[0].c, suites[0].prc
+	key := strconv.Itoa(prc.pr)
+	f.mu.Lock()
+	cursor := f.commandCursor(c.Owner, c.Repo)
+	if cursor.CommandsSince == nil {
+		now := time.Now()
+		cursor.CommandsSince = &now
+	}
+	since, last := *cursor.CommandsSince, cursor.Commands[key]
+	f.mu.Unlock()
+
+	comments, err := c.client.ListPRComments(ctx, prc.pr)
+	if err != nil {
+		return err
+	}
+	allowed := map[string]bool{}
+	for _, comment := range comments {
+		if comment.GetID() <= last || comment.GetCreatedAt().Before(since) {
+			continue
+		}
+		for _, cmd := range parseCommands(comment.GetBody()) {
+			user := comment.GetUser().GetLogin()
+			if _, ok := allowed[user]; !ok {
+				permission, err := c.client.CollaboratorPermission(ctx, user)
+				if err != nil {
+					return err
+				}
+				allowed[user] = permission == "admin" || permission == "write"
+			}
+
+			var reply string
+			if allowed[user] {
+				logrus.Infof("Running %q of %s on pull request #%d", cmd.line, user, prc.pr)
+				if reply, err = f.runCommand(ctx, suites, cmd); err != nil {
+					logrus.Errorf("Failed to run %q on pull request #%d, %v", cmd.line, prc.pr, err)
+					reply = fmt.Sprintf("Failed to run the command, %v", err)
+				}
+			} else {
+				reply = "Only collaborators with write access can use `/flake` commands."
+			}
+			if reply == "" {
+				continue
+			}
+			body := fmt.Sprintf("> %s\n\n@%s %s", cmd.line, user, reply)
+			if err := c.client.PostPRComment(ctx, prc.pr, &body); err != nil {
+				return err
+			}
+		}
+
+		f.mu.Lock()
+		if cursor.Commands == nil {
+			cursor.Commands = map[string]int64{}
+		}
+		cursor.Commands[key] = comment.GetID()
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+// runCommand runs a slash command for the test suites of a pull request and returns the reply to it, or an empty
+// string if the command replied itself. Reports and explanations cover every suite, known flakes are re-run by the
+// first suite only so that a run is not re-run once per suite.
+func (f *CommenterFile) runCommand(ctx context.Context, suites []suitePR, cmd command) (string, error) {
+	c, prc := suites[0].c, suites[0].prc
+	switch cmd.name {
+	case "report":
+		var reported, posted int
+		for _, suite := range suites {
+			if len(suite.prc.runIDs) == 0 {
+				continue
+			}
+			reported++
+			suite.prc.newRunIDs = suite.prc.runIDs
+			comment, err := f.reportPullRequest(ctx, suite.c, suite.prc)
+			if err != nil {
+				return "", err
+			}
+			if comment != nil {
+				posted++
+			}
+		}
+		if reported == 0 {
+			return "There are no test reports of this pull request to report on yet.", nil
+		}
+		if posted == 0 {
+			return "No runs of this pull request failed, there is nothing to report.", nil
+		}
+		return "Posted a fresh report.", nil
+
+	case "explain":
+		if cmd.arg == "" {
+			return "Name the test to explain, e.g. `/flake explain <test>`.", nil
+		}
+		for _, suite := range suites {
+			report, err := f.loadReport(suite.c, prc.pr, "")
+			if err != nil {
+				return "", err
+			}
+			if explanation, ok := report.Explain(cmd.arg); ok {
+				return "\n\n" + explanation, nil
+			}
+		}
+		if f.branch == "" {
+			return fmt.Sprintf("`%s` did not fail on this pull request.", cmd.arg), nil
+		}
+		return fmt.Sprintf("`%s` did not fail on this pull request, nor on %s in the last %d days.", cmd.arg,
+			f.branch, f.baselineDays(c)), nil
+
+	case "rerun":
+		if f.branch == "" {
+			return "Known flakes can only be re-run when the commenter compares failures with a baseline branch.", nil
+		}
+		// Only the runs on the head commit can be re-run usefully.
+		var headRunIDs []string
+		for _, id := range prc.runIDs {
+			if prc.runCommits[id] == prc.head {
+				headRunIDs = append(headRunIDs, id)
+			}
+		}
+		runs, err := c.workflowRuns(ctx, prc, headRunIDs)
+		if err != nil {
+			return "", err
+		}
+		var failedRuns []*github.WorkflowRun
+		for _, run := range runs {
+			if run.GetConclusion() == "failure" && run.GetHeadSHA() == prc.head {
+				failedRuns = append(failedRuns, run)
+			}
+		}
+		if len(failedRuns) == 0 {
+			return "No run of the head commit failed, there is nothing to re-run.", nil
+		}
+		report, err := f.loadReport(c, prc.pr, failedRuns[len(failedRuns)-1].GetHTMLURL())
+		if err != nil {
+			return "", err
+		}
+		// Reruns asked for are not limited by the rerun budget, but count towards it.
+		reruns, err := f.rerunKnownFlakes(ctx, c, prc, report, failedRuns, unlimitedReruns)
+		if err != nil || reruns > 0 {
+			return "", err
+		}
+		return fmt.Sprintf("Not re-running the failed runs of the head commit, their failures are not all known flakes"+
+			" of %s.", f.branch), nil
+
+	case "mute":
+		if cmd.arg == "" {
+			return "Name the test to mute, e.g. `/flake mute <test>`.", nil
+		}
+		return fmt.Sprintf("To stop reporting `%s`, add it to the ignored tests of `.github/flake-analyzer.yaml` on"+
+			" the default branch:\n\n```yaml\nignore:\n  - test: %q\n    reason: %q\n```", cmd.arg, cmd.arg,
+			fmt.Sprintf("Muted in #%d", prc.pr)), nil
+	}
+	return fmt.Sprintf("Unknown command `%s`. %s", cmd.name, commandUsage), nil
+}
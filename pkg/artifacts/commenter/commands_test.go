@@ -0,0 +1,54 @@
+package commenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		commands []command
+	}{
+		{name: "No command", body: "LGTM, but see /flake report"},
+		{name: "Command", body: "/flake report", commands: []command{{line: "/flake report", name: "report"}}},
+		{name: "Command with argument", body: "Why?\r\n/flake explain  Subscription creation \r\nThanks",
+			commands: []command{{line: "/flake explain  Subscription creation", name: "explain",
+				arg: "Subscription creation"}}},
+		{name: "Quoted command", body: "> /flake rerun\n\n@maintainer Re-running"},
+		{name: "Several commands", body: "/flake rerun\n/flake mute e2e/flake",
+			commands: []command{{line: "/flake rerun", name: "rerun"},
+				{line: "/flake mute e2e/flake", name: "mute", arg: "e2e/flake"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.commands, parseCommands(tt.body))
+		})
+	}
+}
+
+func TestCommandCursor(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	later := since.Add(time.Minute)
+	first := &Commenter{Owner: owner, Repo: repo, TestNameMatcher: "e2e", CommandsSince: &later,
+		Commands: map[string]int64{"1": 10, "2": 20}}
+	second := &Commenter{Owner: owner, Repo: repo, TestNameMatcher: "unit", CommandsSince: &since,
+		Commands: map[string]int64{"1": 15, "3": 30}}
+	other := &Commenter{Owner: owner, Repo: "other", CommandsSince: &later, Commands: map[string]int64{"1": 5}}
+	f := &CommenterFile{Commented: []*Commenter{other, first, second}}
+
+	// The cursors of the suites of a repository are merged into the first one.
+	cursor := f.commandCursor(owner, repo)
+	assert.Same(t, first, cursor)
+	assert.Equal(t, &since, cursor.CommandsSince)
+	assert.Equal(t, map[string]int64{"1": 15, "2": 20, "3": 30}, cursor.Commands)
+	assert.Nil(t, second.Commands)
+	assert.Nil(t, second.CommandsSince)
+	assert.Equal(t, map[string]int64{"1": 5}, other.Commands)
+
+	cursor.pruneCommands(map[int][]suitePR{3: {{c: first}}})
+	assert.Equal(t, map[string]int64{"3": 30}, cursor.Commands)
+}
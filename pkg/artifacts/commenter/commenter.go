@@ -3,191 +3,732 @@ package commenter
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/google/go-github/v32/github"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 
 	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
 	fgithub "github.com/operator-framework/flak-analyzer/pkg/github"
 )
 
 type CommenterFile struct {
-	client       *fgithub.RepositoryClient
-	owner        string
-	repo         string
-	artifactName string
-	progressFile string
-	Commented    []*Commenter `json:"commented"`
+	// client accesses the analyzer repository, analyzed repositories are only accessed with the clients of their
+	// commenters.
+	client      *fgithub.RepositoryClient
+	owner       string
+	repo        string
+	store       ProgressStore
+	unlock      func() error
+	options     []fgithub.ClientOption
+	commentMode reporter.CommentMode
+	history     int
+	template    *template.Template
+	comments    bool
+	checkRuns   bool
+	branch      string
+	branchDays  int
+	rerunBudget int
+	retention   time.Duration
+	labels      *PRLabels
+	// summaryComment and summaryDir configure the summaries of merged and closed pull requests, see SetPRSummaries.
+	summaryComment bool
+	summaryDir     string
+	quiet          QuietPolicy
+	commands       bool
+	concurrency    int
+	watch          watchState
+	// repos are the repositories added with AddRepo, whose configuration files are reloaded as they change.
+	repos []*addedRepo
+	// mu guards the progress and the results, as pull requests are reported on concurrently by webhooks and
+	// repositories by GenerateComments. It is never held while calling GitHub.
+	mu sync.Mutex
+	// saveMu orders the saves of the progress, which are made from snapshots taken under mu.
+	saveMu  sync.Mutex
+	results []RepoResult
+	// reportedPRs counts the pull requests reported on by the current GenerateComments, see QuietPolicy.MaxPRs.
+	reportedPRs int
+	Commented   []*Commenter `json:"commented"`
 }
 
 type Commenter struct {
-	client          *fgithub.RepositoryClient
-	token           string
-	Owner           string              `json:"owner"`
-	Repo            string              `json:"repo"`
-	TestNameMatcher string              `json:"test_name_matcher"`
-	RunIDs          map[string]struct{} `json:"run_id"`
+	client  *fgithub.RepositoryClient
+	token   string
+	options []fgithub.ClientOption
+	// active tells whether the test suite is commented on. The progress keeps suites no longer commented on, e.g.
+	// replaced by the suites of a configuration file.
+	active          bool
+	Owner           string `json:"owner"`
+	Repo            string `json:"repo"`
+	TestNameMatcher string `json:"test_name_matcher"`
+	// Runs holds the runs reported on by ID.
+	Runs map[string]*RunRecord `json:"runs"`
+	// RunIDs lists the runs reported on in progress of version 1, they are moved to Runs when it is loaded.
+	RunIDs map[string]struct{} `json:"run_id,omitempty" yaml:",omitempty"`
+	// Reruns lists the reruns triggered on each open pull request by number.
+	Reruns map[string][]Rerun `json:"reruns"`
+	// Commands holds the ID of the last comment scanned for slash commands on each open pull request by number.
+	// CommandsSince is when comments were first scanned for slash commands, older comments are not. Both are kept by
+	// the first test suite of a repository in the progress for all its suites, see commandCursor.
+	Commands      map[string]int64 `json:"commands"`
+	CommandsSince *time.Time       `json:"commands_since"`
+	// config is the configuration file of the analyzed repository, nil if it has none.
+	config *RepoConfig
+
+	// artifacts and commits are kept between the polls of a watching commenter, so that only new artifacts and the
+	// commits of pull requests with a new head are listed. listMu guards them while they are listed.
+	listMu    sync.Mutex
+	artifacts []*github.Artifact
+	listed    time.Time
+	commits   map[int]prCommits
+
+	// baseline caches the failures on the baseline branch that reports are classified against, see loadBaseline.
+	baselineMu     sync.Mutex
+	baseline       *reporter.Baseline
+	baselineDays   int
+	baselineLoaded time.Time
 }
 
-func NewCommenter(commenterOwner, commenterRepo, commenterToken, artifactName, progressFile string) (*CommenterFile, error) {
-	ctx := context.Background()
+type prCommits struct {
+	head    string
+	commits []string
+}
+
+// RunRecord is what the commenter remembers of a run it reported on.
+type RunRecord struct {
+	PR     int    `json:"pr"`
+	Commit string `json:"commit"`
+	// FirstSeen is when the run was first reported on.
+	FirstSeen time.Time `json:"first_seen"`
+	// Commented tells whether the report on the run was posted as a comment, CommentID is the ID of the comment.
+	Commented bool  `json:"commented"`
+	CommentID int64 `json:"comment_id,omitempty"`
+	// CommentedAt is when the comment was last posted or updated with a report on the run, nil if it was not or if
+	// the run was recorded before it was kept.
+	CommentedAt *time.Time `json:"commented_at,omitempty"`
+	// ExpiresAt is when the test report artifacts of the run expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Closed is when the pull request of the run was first found closed, nil while it is open.
+	Closed *time.Time `json:"closed,omitempty"`
+	// Artifacts is the number of test report artifacts the run had when last reported on, zero if unknown. Every
+	// attempt of a re-run run uploads its own artifacts under the same name, so more artifacts mean a new attempt.
+	Artifacts int `json:"artifacts,omitempty"`
+}
+
+// Rerun records a workflow run whose failed jobs were re-run because all its failed tests were known flakes.
+type Rerun struct {
+	RunID  int64     `json:"run_id"`
+	Commit string    `json:"commit"`
+	Tests  []string  `json:"tests"`
+	Time   time.Time `json:"time"`
+}
+
+// NewCommenter returns a commenter keeping its progress in the newest artifact called artifactName of the analyzer
+// repository, see ArtifactStore.
+func NewCommenter(commenterOwner, commenterRepo, commenterToken, artifactName, progressFile string,
+	options ...fgithub.ClientOption) (*CommenterFile, error) {
+	client, err := fgithub.NewRepositoryClient(context.Background(), commenterToken, commenterOwner, commenterRepo,
+		false, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newCommenter(client, NewArtifactStore(client, artifactName, progressFile), options)
+}
+
+// NewCommenterWithStore returns a commenter keeping its progress in store. Stores implementing Locker stay locked
+// until Close is called.
+func NewCommenterWithStore(commenterOwner, commenterRepo, commenterToken string, store ProgressStore,
+	options ...fgithub.ClientOption) (*CommenterFile, error) {
+	client, err := fgithub.NewRepositoryClient(context.Background(), commenterToken, commenterOwner, commenterRepo,
+		false, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newCommenter(client, store, options)
+}
+
+func newCommenter(client *fgithub.RepositoryClient, store ProgressStore, options []fgithub.ClientOption) (
+	*CommenterFile, error) {
 	f := &CommenterFile{
-		client:       fgithub.NewRepositoryClient(ctx, commenterToken, commenterOwner, commenterRepo, false),
-		owner:        commenterOwner,
-		repo:         commenterRepo,
-		artifactName: artifactName,
-		progressFile: progressFile,
-		Commented:    []*Commenter{},
+		client:    client,
+		owner:     client.Owner,
+		repo:      client.Repo,
+		store:     store,
+		options:   options,
+		comments:  true,
+		Commented: []*Commenter{},
 	}
 
-	if err := f.getLatestCommenterFile(ctx); err != nil {
+	if err := f.loadProgress(context.Background()); err != nil {
+		f.Close()
 		return nil, err
 	}
 	return f, nil
 }
 
+// Close releases the progress store if it is locked.
+func (f *CommenterFile) Close() error {
+	if f.unlock == nil {
+		return nil
+	}
+	unlock := f.unlock
+	f.unlock = nil
+	return unlock()
+}
+
+// SetCommentMode configures how report comments already posted on a pull request are handled, see
+// reporter.WithCommentMode and reporter.WithCommentHistory.
+func (f *CommenterFile) SetCommentMode(mode reporter.CommentMode, history int) {
+	f.commentMode = mode
+	f.history = history
+}
+
+// SetCommentTemplate renders pull request comments with t, see reporter.LoadTemplate.
+func (f *CommenterFile) SetCommentTemplate(t *template.Template) {
+	f.template = t
+}
+
+// SetPublishing selects whether reports are posted as pull request comments, published as check runs on the pull
+// request head commit, or both. Only comments are posted by default.
+func (f *CommenterFile) SetPublishing(comments, checkRuns bool) {
+	f.comments = comments
+	f.checkRuns = checkRuns
+}
+
+// SetBaseline classifies the failures on pull requests against the failures on branch over the last days, see
+// reporter.FlakeReport.CompareWithBranch. An empty branch disables the classification.
+func (f *CommenterFile) SetBaseline(branch string, days int) {
+	f.branch = branch
+	f.branchDays = days
+}
+
+// SetRerunBudget re-runs the failed jobs of pull request runs in which all failed tests are known flakes, at most
+// budget times per pull request. It requires a baseline, see SetBaseline. A zero budget disables reruns.
+func (f *CommenterFile) SetRerunBudget(budget int) {
+	f.rerunBudget = budget
+}
+
+// SetRetention keeps the runs of closed pull requests in the progress for the retention, so that pull requests
+// reopened meanwhile are not reported on again. Runs whose artifacts expired are pruned right away.
+func (f *CommenterFile) SetRetention(retention time.Duration) {
+	f.retention = retention
+}
+
+// AddRepo comments on the pull requests of a repository. The test suites and settings of its configuration file, see
+// RepoConfig, are read from its default branch and take precedence over testNameMatcher and the commenter's settings.
 func (f *CommenterFile) AddRepo(owner, repo, token, testNameMatcher string) error {
-	if owner == "" || repo == "" || token == "" {
-		return fmt.Errorf("commenting requires Owner, Repo, and Token to be not empty")
+	return f.AddRepoSuites(owner, repo, token, []string{testNameMatcher})
+}
+
+// AddRepoSuites comments on the pull requests of a repository for each of the test suite filters testNameMatchers,
+// see AddRepo.
+func (f *CommenterFile) AddRepoSuites(owner, repo, token string, testNameMatchers []string) error {
+	if owner == "" || repo == "" || (token == "" && !fgithub.HasCredentials(f.options...)) {
+		return fmt.Errorf("commenting requires Owner, Repo, and Token or GitHub App credentials to be not empty")
 	}
 	ctx := context.Background()
+	client, err := fgithub.NewRepositoryClient(ctx, token, owner, repo, false, f.options...)
+	if err != nil {
+		return err
+	}
+	r := &addedRepo{client: client, token: token, matchers: testNameMatchers}
+	if err := f.loadRepoConfig(ctx, r); err != nil {
+		return err
+	}
+	f.repos = append(f.repos, r)
+	return nil
+}
+
+// addedRepo is a repository added with AddRepoSuites.
+type addedRepo struct {
+	client   *fgithub.RepositoryClient
+	token    string
+	matchers []string
+	// suites are the test suites commented on since the configuration file was loaded.
+	suites []string
+	loaded time.Time
+}
+
+// configTTL is how long the configuration file of a repository is used before polls read it again.
+const configTTL = time.Minute
+
+// loadRepoConfig reads the configuration file of an added repository and comments on its test suites, or on the ones
+// the repository was added with if the file lists none. Suites no longer listed are not commented on anymore.
+func (f *CommenterFile) loadRepoConfig(ctx context.Context, r *addedRepo) error {
+	config, err := LoadRepoConfig(ctx, r.client)
+	if err != nil {
+		return err
+	}
+	owner, repo := r.client.Owner, r.client.Repo
+
+	matchers := r.matchers
+	if len(matchers) == 0 {
+		matchers = []string{""}
+	}
+	if config != nil && len(config.Suites) > 0 {
+		matchers = nil
+		for _, s := range config.Suites {
+			matchers = append(matchers, s.matcher())
+		}
+		if strings.Join(matchers, "\n") != strings.Join(r.suites, "\n") {
+			logrus.Infof("Commenting on %d test suites of %s/%s configured in %s", len(matchers), owner, repo,
+				RepoConfigPath)
+		}
+	}
+
+	previous := map[string]bool{}
+	for _, matcher := range r.suites {
+		previous[matcher] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.Commented {
+		if c.Owner == owner && c.Repo == repo && previous[c.TestNameMatcher] {
+			c.active = false
+		}
+	}
+	for _, matcher := range matchers {
+		f.addCommenter(r.client, owner, repo, r.token, matcher, config)
+	}
+	r.suites, r.loaded = matchers, time.Now()
+	return nil
+}
+
+// reloadRepoConfigs reads the configuration files of the added repositories again once older than configTTL. A
+// repository keeps its previous configuration if its file cannot be read or is invalid.
+func (f *CommenterFile) reloadRepoConfigs(ctx context.Context) {
+	for _, r := range f.repos {
+		if time.Since(r.loaded) < configTTL {
+			continue
+		}
+		if err := f.loadRepoConfig(ctx, r); err != nil {
+			logrus.Warnf("Keeping the previous configuration of %s/%s, %v", r.client.Owner, r.client.Repo, err)
+		}
+	}
+}
 
+// reloadRepoConfig reads the configuration file of an added repository again, e.g. when its default branch changed.
+func (f *CommenterFile) reloadRepoConfig(ctx context.Context, owner, repo string) error {
+	for _, r := range f.repos {
+		if strings.EqualFold(r.client.Owner, owner) && strings.EqualFold(r.client.Repo, repo) {
+			if err := f.loadRepoConfig(ctx, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *CommenterFile) addCommenter(client *fgithub.RepositoryClient, owner, repo, token, testNameMatcher string,
+	config *RepoConfig) {
 	for i, entry := range f.Commented {
 		if entry.Owner == owner && entry.Repo == repo && entry.TestNameMatcher == testNameMatcher {
-			f.Commented[i].client = fgithub.NewRepositoryClient(ctx, token, owner, repo, false)
+			f.Commented[i].client = client
 			f.Commented[i].token = token
-			return nil
+			f.Commented[i].options = f.options
+			f.Commented[i].config = config
+			f.Commented[i].active = true
+			return
 		}
 	}
 	f.Commented = append(f.Commented, &Commenter{
-		client:          fgithub.NewRepositoryClient(ctx, token, owner, repo, false),
+		client:          client,
 		token:           token,
+		options:         f.options,
+		active:          true,
+		config:          config,
 		Owner:           owner,
 		Repo:            repo,
 		TestNameMatcher: testNameMatcher,
-		RunIDs:          map[string]struct{}{},
+		Runs:            map[string]*RunRecord{},
 	})
-	return nil
 }
 
+// GenerateComments reports the new runs of the open pull requests of every repository added with AddRepo and saves
+// the progress. Repositories are commented on concurrently, see SetConcurrency, and a repository failing does not stop
+// the others: the comments posted are returned along with the errors, and the outcome per repository with Results.
 func (f *CommenterFile) GenerateComments() ([]*string, error) {
 	ctx := context.Background()
+	comments, repoErr := f.generateAllComments(ctx)
+	if err := f.saveProgress(ctx); err != nil {
+		return nil, err
+	}
+	return comments, repoErr
+}
+
+// generateRepoComments reports the new runs of the open pull requests of a repository, for each of its test suites.
+func (f *CommenterFile) generateRepoComments(ctx context.Context, commenters []*Commenter) ([]*string, RepoResult) {
+	result := RepoResult{Owner: commenters[0].Owner, Repo: commenters[0].Repo, Suites: len(commenters)}
 	var comments []*string
-	for _, c := range f.Commented {
-		prcs, err := c.generatePRComments(ctx)
+	// Every suite lists the open pull requests, which are counted once.
+	open, reported := map[int]bool{}, map[int]bool{}
+	// suites holds the open pull requests as seen by each test suite, in order, for their slash commands.
+	var numbers []int
+	suites := map[int][]suitePR{}
+	for _, c := range commenters {
+		prcs, closed, expiries, err := f.generatePRComments(ctx, c)
 		if err != nil {
-			return nil, err
+			result.Err = err
+			break
 		}
 		for _, prc := range prcs {
-			// Only consider new Runs
-			hasFailedRuns := false
-			for _, id := range prc.newRunIDs {
-				idnum, err := strconv.ParseInt(id, 10, 64)
+			open[prc.pr] = true
+			if len(prc.newRunIDs) > 0 {
+				reason, err := f.holdBack(ctx, c, prc)
 				if err != nil {
-					return nil, err
+					result.Err = err
+					break
 				}
-				fw, _, err := f.client.Actions.GetWorkflowRunByID(ctx, c.Owner, c.Repo, idnum)
-				if err != nil {
-					return nil, err
+				var comment *string
+				if reason == "" {
+					prc.capped = true
+					comment, err = f.reportPullRequest(ctx, c, prc)
 				}
-
-				// Only comment on the PR if new runs failed.
-				if fw.GetConclusion() == "failure" {
-					hasFailedRuns = true
+				switch {
+				case err == errCapped:
+					reason = err.Error()
+				case err != nil:
+					result.Err = err
+				case comment != nil:
+					comments = append(comments, comment)
+				}
+				if result.Err != nil {
+					break
+				}
+				if reason != "" {
+					logrus.Infof("Holding back the report on pull request %s/%s#%d, %s", c.Owner, c.Repo, prc.pr,
+						reason)
+					result.HeldBack++
+				} else {
+					reported[prc.pr] = true
 				}
 			}
-
-			if !hasFailedRuns {
-				continue
-			}
-
-			report := reporter.NewFlakeReport()
-			if err = report.LoadReport(reporter.RepositoryInfo(c.Owner, c.Repo), reporter.WithToken(c.token),
-				reporter.FilterPR(strconv.Itoa(prc.pr)),
-				reporter.FilterTestSuite(c.TestNameMatcher)); err != nil {
-				return nil, err
+			if f.commands {
+				if suites[prc.pr] == nil {
+					numbers = append(numbers, prc.pr)
+				}
+				suites[prc.pr] = append(suites[prc.pr], suitePR{c: c, prc: prc})
 			}
-			comment, err := report.PostReportAsPullRequestComment()
-			if err != nil {
-				if err == reporter.ErrorNothingToReport {
-					continue
+		}
+		if result.Err != nil {
+			break
+		}
+		if f.summaries() {
+			for _, pr := range closed {
+				if err := f.summarizePullRequest(ctx, c, pr); err != nil {
+					result.Err = err
+					break
 				}
-				return nil, err
+				// Pull requests summarized are closed right away, so that a failure only summarizes the others again.
+				f.mu.Lock()
+				c.closeRuns(pr.number, time.Now())
+				f.mu.Unlock()
+				result.Summarized++
+			}
+			if result.Err != nil {
+				break
+			}
+		}
+		f.mu.Lock()
+		c.retainRuns(prcs, expiries, time.Now(), f.retention)
+		f.mu.Unlock()
+	}
+	if f.commands && result.Err == nil {
+		for _, number := range numbers {
+			if err := f.handleCommands(ctx, suites[number]); err != nil {
+				result.Err = err
+				break
 			}
-
-			comments = append(comments, comment)
 		}
+		if result.Err == nil {
+			f.mu.Lock()
+			f.commandCursor(result.Owner, result.Repo).pruneCommands(suites)
+			f.mu.Unlock()
+		}
+	}
+	result.PullRequests, result.Reported, result.Comments = len(open), len(reported), len(comments)
+	if result.Err != nil {
+		logrus.Errorf("Failed to comment on pull requests of %s/%s, %v", result.Owner, result.Repo, result.Err)
 	}
+	return comments, result
+}
 
-	if err := f.saveCommneterFile(); err != nil {
+// reportPullRequest reports the new runs of a pull request, records them in the progress, and returns the report
+// comment if one was posted. Runs are only recorded once reported on, so that a failed poll reports on them again.
+func (f *CommenterFile) reportPullRequest(ctx context.Context, c *Commenter, prc pullRequest) (*string, error) {
+	comment, commentID, err := f.reportRuns(ctx, c, prc)
+	if err != nil {
 		return nil, err
 	}
-
-	return comments, nil
+	f.mu.Lock()
+	c.recordRuns(prc, commentID, time.Now())
+	f.mu.Unlock()
+	return comment, nil
 }
 
-func (f *CommenterFile) saveCommneterFile() error {
-	data, err := yaml.Marshal(f)
+// reportRuns reports the new runs of a pull request, and returns the report comment and its ID if one was posted.
+func (f *CommenterFile) reportRuns(ctx context.Context, c *Commenter, prc pullRequest) (*string, int64, error) {
+	// Only consider new Runs
+	newRuns, err := c.workflowRuns(ctx, prc, prc.newRunIDs)
 	if err != nil {
-		return err
+		return nil, 0, err
+	}
+	var failedRuns []*github.WorkflowRun
+	for _, fw := range newRuns {
+		// Only comment on the PR if new runs failed.
+		if fw.GetConclusion() == "failure" {
+			failedRuns = append(failedRuns, fw)
+		}
 	}
 
-	if f.progressFile == "" {
-		f.progressFile = "./commenter_progress_file.yaml"
+	if len(failedRuns) == 0 {
+		if f.labels != nil {
+			if err := f.labelPR(ctx, c, prc, nil, newRuns); err != nil {
+				return nil, 0, err
+			}
+		}
+		return nil, 0, nil
 	}
-	if err := os.MkdirAll(filepath.Dir(f.progressFile), 0700); err != nil {
-		return err
+
+	if prc.capped && !f.reserveReport() {
+		return nil, 0, errCapped
 	}
-	if err := ioutil.WriteFile(f.progressFile, data, 0644); err != nil {
-		return err
+
+	// Comments too long to post in full link to the artifacts of the latest failed run.
+	report, err := f.loadReport(c, prc.pr, failedRuns[len(failedRuns)-1].GetHTMLURL())
+	if err != nil {
+		return nil, 0, err
 	}
-	logrus.Infof("Commenter progress file saved as %s", f.progressFile)
-	return nil
+	if f.branch != "" && f.labels != nil {
+		if err := f.labelPR(ctx, c, prc, report, newRuns); err != nil {
+			return nil, 0, err
+		}
+	}
+	if budget := f.rerunBudgetOf(c); f.branch != "" && budget > 0 {
+		if _, err := f.rerunKnownFlakes(ctx, c, prc, report, failedRuns, budget); err != nil {
+			return nil, 0, err
+		}
+	}
+	if f.checkRuns {
+		if _, err := report.PublishCheckRun(reporter.WithHeadSHA(prc.head)); err != nil {
+			return nil, 0, err
+		}
+	}
+	if !f.comments {
+		return nil, 0, nil
+	}
+	comment, err := f.postReport(ctx, c, report)
+	if err == reporter.ErrorNothingToReport {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return comment, report.CommentID(), nil
+}
+
+// loadReport loads the report of the test suite on a pull request, without the tests the repository leaves out, and
+// classified against the baseline branch if one is set. reportURL links to the full report from comments too long to
+// post in full.
+func (f *CommenterFile) loadReport(c *Commenter, pr int, reportURL string) (*reporter.FlakeReport, error) {
+	report := reporter.NewFlakeReport()
+	if err := report.LoadReport(reporter.RepositoryInfo(c.Owner, c.Repo), reporter.WithToken(c.token),
+		reporter.FilterPR(strconv.Itoa(pr)),
+		reporter.FilterTestSuite(c.TestNameMatcher), reporter.WithClientOptions(c.options...),
+		reporter.WithReportURL(reportURL)); err != nil {
+		return nil, err
+	}
+	if c.config != nil {
+		if removed := report.RemoveTests(c.config.removed); len(removed) > 0 {
+			logrus.Infof("Left %d ignored or rare failed tests out of the report on pull request #%d", len(removed), pr)
+		}
+	}
+	if f.branch != "" {
+		baseline, err := f.loadBaseline(c)
+		if err != nil {
+			return nil, err
+		}
+		report.ClassifyAgainst(baseline)
+	}
+	return report, nil
 }
 
-func (f *CommenterFile) getLatestCommenterFile(ctx context.Context) error {
-	commenterArtifacts, err := f.client.ListAllArtifacts(ctx)
+// baselineTTL is how long the failures on the baseline branch are reused for the reports on the pull requests of a
+// test suite, e.g. across the polls of a watching commenter and across webhooks.
+const baselineTTL = 10 * time.Minute
+
+// loadBaseline returns the failures of the test suite of c on the baseline branch, loaded once per baselineTTL rather
+// than for every report.
+func (f *CommenterFile) loadBaseline(c *Commenter) (*reporter.Baseline, error) {
+	days := f.baselineDays(c)
+	c.baselineMu.Lock()
+	defer c.baselineMu.Unlock()
+	if c.baseline != nil && c.baselineDays == days && time.Since(c.baselineLoaded) < baselineTTL {
+		return c.baseline, nil
+	}
+	baseline, err := reporter.LoadBaseline(f.branch, days, reporter.RepositoryInfo(c.Owner, c.Repo),
+		reporter.WithToken(c.token), reporter.FilterTestSuite(c.TestNameMatcher),
+		reporter.WithClientOptions(c.options...))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	c.baseline, c.baselineDays, c.baselineLoaded = baseline, days, time.Now()
+	return baseline, nil
+}
 
-	if commenterArtifacts != nil {
-		if len(commenterArtifacts) > 1 {
-			sort.Slice(commenterArtifacts, func(i, j int) bool {
-				return commenterArtifacts[i].GetCreatedAt().Time.After(commenterArtifacts[j].GetCreatedAt().Time)
-			})
+// unlimitedReruns is the budget of the reruns asked for with /flake rerun, which are not limited by the rerun budget.
+const unlimitedReruns = -1
+
+// rerunKnownFlakes re-runs the failed jobs of the failed runs on the pull request head whose failed tests are all
+// known flakes, as long as the rerun budget of the pull request lasts, and returns the number of reruns. The budget is
+// unlimitedReruns or the number of reruns per pull request, zero disables reruns. Every rerun is explained in a comment.
+func (f *CommenterFile) rerunKnownFlakes(ctx context.Context, c *Commenter, pr pullRequest,
+	report *reporter.FlakeReport, runs []*github.WorkflowRun, budget int) (int, error) {
+	key := strconv.Itoa(pr.pr)
+	var reruns int
+	for _, run := range runs {
+		// Re-running an outdated commit does not help the pull request.
+		if run.GetHeadSHA() != pr.head {
+			continue
+		}
+		tests, ok := report.KnownFlakesOn(run.GetHeadSHA())
+		if !ok {
+			continue
 		}
+		f.mu.Lock()
+		if budget != unlimitedReruns && len(c.Reruns[key]) >= budget {
+			f.mu.Unlock()
+			logrus.Infof("Not re-running run %d of pull request #%d, the budget of %d reruns is used up",
+				run.GetID(), pr.pr, budget)
+			continue
+		}
+		// The rerun is recorded before it is requested, so that concurrent reports do not exceed the budget.
+		if c.Reruns == nil {
+			c.Reruns = map[string][]Rerun{}
+		}
+		rerun := Rerun{
+			RunID:  run.GetID(),
+			Commit: run.GetHeadSHA(),
+			Tests:  tests,
+			Time:   time.Now(),
+		}
+		c.Reruns[key] = append(c.Reruns[key], rerun)
+		n := len(c.Reruns[key])
+		f.mu.Unlock()
 
-		for _, ar := range commenterArtifacts {
-			if ar.GetName() != f.artifactName {
-				continue
-			}
-			dir, err := ioutil.TempDir("./", "commenter-progress-")
-			if err != nil {
-				return err
-			}
+		if err := c.client.RerunFailedJobs(ctx, run.GetID()); err != nil {
+			f.mu.Lock()
+			c.forgetRerun(key, rerun)
+			f.mu.Unlock()
+			return reruns, err
+		}
+		reruns++
+		logrus.Infof("Re-running the failed jobs of run %d of pull request #%d", run.GetID(), pr.pr)
 
-			if _, err = f.client.DownloadArtifacts(ctx, []*github.Artifact{ar}, dir, "", nil, nil); err != nil {
-				return err
-			}
-			content, err := reporter.Unzip(filepath.Join(dir, ar.GetName()+".zip"))
-			if err != nil {
-				return err
-			}
-			if err = yaml.Unmarshal(content, f); err != nil {
-				return err
-			}
-			return nil
+		var b strings.Builder
+		if budget != unlimitedReruns {
+			fmt.Fprintf(&b, "Re-running the failed jobs of [run %d](%s) (rerun %d of %d on this pull request): ",
+				run.GetID(), run.GetHTMLURL(), n, budget)
+		} else {
+			fmt.Fprintf(&b, "Re-running the failed jobs of [run %d](%s) (rerun %d on this pull request): ",
+				run.GetID(), run.GetHTMLURL(), n)
+		}
+		if len(tests) == 1 {
+			b.WriteString("the failed test is a known flake")
+		} else {
+			fmt.Fprintf(&b, "all %d failed tests are known flakes", len(tests))
+		}
+		fmt.Fprintf(&b, ", failing with the same errors on %s in the last %d days.\n\n", f.branch, f.baselineDays(c))
+		for _, t := range tests {
+			fmt.Fprintf(&b, "* `%s`\n", t)
+		}
+		comment := b.String()
+		if err := c.client.PostPRComment(ctx, pr.pr, &comment); err != nil {
+			return reruns, err
+		}
+	}
+	return reruns, nil
+}
+
+// forgetRerun removes a rerun of a pull request that could not be requested.
+func (c *Commenter) forgetRerun(key string, rerun Rerun) {
+	reruns := c.Reruns[key]
+	for i, r := range reruns {
+		if r.RunID == rerun.RunID && r.Time.Equal(rerun.Time) {
+			c.Reruns[key] = append(reruns[:i:i], reruns[i+1:]...)
+			return
 		}
 	}
+}
+
+// saveProgress saves a snapshot of the progress, so that reports go on while it is saved.
+func (f *CommenterFile) saveProgress(ctx context.Context) error {
+	// Dry runs leave the progress as it was, so that the runs are reported on for real later.
+	if fgithub.IsDryRun(f.options...) {
+		return nil
+	}
+	f.saveMu.Lock()
+	defer f.saveMu.Unlock()
+	f.mu.Lock()
+	progress := &Progress{Version: ProgressVersion}
+	for _, c := range f.Commented {
+		progress.Commented = append(progress.Commented, c.snapshot())
+	}
+	f.mu.Unlock()
+	return f.store.Save(ctx, progress)
+}
+
+// snapshot returns a copy of the progress of c.
+func (c *Commenter) snapshot() *Commenter {
+	s := &Commenter{Owner: c.Owner, Repo: c.Repo, TestNameMatcher: c.TestNameMatcher, CommandsSince: c.CommandsSince}
+	if c.Runs != nil {
+		s.Runs = make(map[string]*RunRecord, len(c.Runs))
+		for id, r := range c.Runs {
+			record := *r
+			s.Runs[id] = &record
+		}
+	}
+	if c.RunIDs != nil {
+		s.RunIDs = make(map[string]struct{}, len(c.RunIDs))
+		for id := range c.RunIDs {
+			s.RunIDs[id] = struct{}{}
+		}
+	}
+	if c.Reruns != nil {
+		s.Reruns = make(map[string][]Rerun, len(c.Reruns))
+		for pr, reruns := range c.Reruns {
+			s.Reruns[pr] = append([]Rerun(nil), reruns...)
+		}
+	}
+	if c.Commands != nil {
+		s.Commands = make(map[string]int64, len(c.Commands))
+		for pr, id := range c.Commands {
+			s.Commands[pr] = id
+		}
+	}
+	return s
+}
+
+func (f *CommenterFile) loadProgress(ctx context.Context) error {
+	if locker, ok := f.store.(Locker); ok {
+		unlock, err := locker.Lock(ctx)
+		if err != nil {
+			return err
+		}
+		f.unlock = unlock
+	}
+	progress, err := f.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		f.Commented = progress.Commented
+	}
 	return nil
 }
 
@@ -201,79 +742,229 @@ func (f *CommenterFile) getLatestCommenterFile(ctx context.Context) error {
 
 type pullRequest struct {
 	pr        int
+	head      string
+	draft     bool
+	labels    []string
 	commits   []string
 	runIDs    []string
 	newRunIDs []string
+	// runCommits maps the runs of the pull request to the commits they ran on.
+	runCommits map[string]string
+	// runArtifacts counts the test report artifacts of the runs of the pull request.
+	runArtifacts map[string]int
+	// capped tells whether reporting on the pull request counts against QuietPolicy.MaxPRs.
+	capped bool
 }
 
-func (c *Commenter) generatePRComments(ctx context.Context) ([]pullRequest, error) {
+// generatePRComments returns the open pull requests with their new runs, the pull requests merged or closed since the
+// last poll, and when the artifacts of the runs with unexpired artifacts expire. The progress is only locked once
+// everything is listed, to find the new runs and forget the closed pull requests.
+func (f *CommenterFile) generatePRComments(ctx context.Context, c *Commenter) ([]pullRequest, []closedPR,
+	map[string]time.Time, error) {
 	PRs, err := c.listPRs(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	artifacts, err := c.client.ListAllArtifacts(ctx)
+	artifacts, err := c.listArtifacts(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	commitRunIDsMap := map[string][]string{}
-	for _, ar := range artifacts {
-		matchTestName, err := regexp.MatchString(c.TestNameMatcher, ar.GetName())
+	commitRunIDsMap, runArtifacts, err := c.commitRunIDs(artifacts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	expiries, err := c.runExpiries(artifacts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	commits, err := c.prCommits(ctx, PRs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var pullRequests []pullRequest
+	for _, pr := range PRs {
+		commitNums := commits[pr.GetNumber()].commits
+		var runIDs []string
+		runCommits := map[string]string{}
+		for _, cNum := range commitNums {
+			runIDs = append(runIDs, commitRunIDsMap[cNum]...)
+			for _, id := range commitRunIDsMap[cNum] {
+				runCommits[id] = cNum
+			}
+		}
+		pullRequests = append(pullRequests, pullRequest{
+			pr:           pr.GetNumber(),
+			head:         pr.GetHead().GetSHA(),
+			draft:        pr.GetDraft(),
+			labels:       labelNames(pr.Labels),
+			commits:      commitNums,
+			runIDs:       runIDs,
+			runCommits:   runCommits,
+			runArtifacts: runArtifacts,
+		})
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	open := map[int]bool{}
+	for _, pr := range PRs {
+		open[pr.GetNumber()] = true
+	}
+	// The reruns of closed pull requests are forgotten below, they are summarized first.
+	closed := c.closedPRs(open)
+
+	updatedReruns := map[string][]Rerun{}
+	for i, prc := range pullRequests {
+		if reruns, ok := c.Reruns[strconv.Itoa(prc.pr)]; ok {
+			updatedReruns[strconv.Itoa(prc.pr)] = reruns
+		}
+		pullRequests[i].newRunIDs = c.newRunIDs(prc.runIDs, runArtifacts)
+	}
+	c.Reruns = updatedReruns
+	return pullRequests, closed, expiries, nil
+}
+
+// prCommits returns the commits of the open pull requests by number. Only the commits of pull requests with a new
+// head since the last poll are listed.
+func (c *Commenter) prCommits(ctx context.Context, prs []*github.PullRequest) (map[int]prCommits, error) {
+	c.listMu.Lock()
+	defer c.listMu.Unlock()
+	updated := map[int]prCommits{}
+	for _, pr := range prs {
+		commitNums := c.commits[pr.GetNumber()].commits
+		if head := pr.GetHead().GetSHA(); head == "" || c.commits[pr.GetNumber()].head != head {
+			var err error
+			if commitNums, err = c.client.ListCommitsFromPR(ctx, pr.GetNumber()); err != nil {
+				return nil, err
+			}
+		}
+		updated[pr.GetNumber()] = prCommits{head: pr.GetHead().GetSHA(), commits: commitNums}
+	}
+	c.commits = updated
+	return updated, nil
+}
+
+// workflowRuns returns the runs of a pull request with the given IDs. The runs on each commit are listed at once,
+// runs missing from the list are looked up one by one.
+func (c *Commenter) workflowRuns(ctx context.Context, prc pullRequest, ids []string) ([]*github.WorkflowRun, error) {
+	byID := map[string]*github.WorkflowRun{}
+	listed := map[string]bool{}
+	for _, id := range ids {
+		commit, ok := prc.runCommits[id]
+		if !ok || listed[commit] {
+			continue
+		}
+		listed[commit] = true
+		runs, err := c.client.ListCommitRuns(ctx, commit)
 		if err != nil {
 			return nil, err
 		}
-		if ar.GetExpired() || !matchTestName {
-			continue
+		for _, run := range runs {
+			byID[strconv.FormatInt(run.GetID(), 10)] = run
+		}
+	}
+
+	var runs []*github.WorkflowRun
+	for _, id := range ids {
+		run, ok := byID[id]
+		if !ok {
+			idnum, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if run, _, err = c.client.Actions.GetWorkflowRunByID(ctx, c.Owner, c.Repo, idnum); err != nil {
+				return nil, err
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// commitRunIDs maps commits to the runs with test report artifacts of the test suite on them, and counts the
+// artifacts of each run. Artifacts are named <test suite>-<commit>-<run ID>.
+func (c *Commenter) commitRunIDs(artifacts []*github.Artifact) (map[string][]string, map[string]int, error) {
+	commitRunIDsMap := map[string][]string{}
+	runArtifacts := map[string]int{}
+	for _, ar := range artifacts {
+		commitNum, runID, ok, err := c.artifactRun(ar)
+		if err != nil {
+			return nil, nil, err
 		}
-		splits := strings.Split(ar.GetName(), "-")
-		if len(splits) < 2 {
+		if !ok {
 			continue
 		}
-		commitNum := splits[len(splits)-2]
-		runID := splits[len(splits)-1]
-		if runs, ok := commitRunIDsMap[commitNum]; !ok {
-			commitRunIDsMap[commitNum] = []string{runID}
-		} else {
-			commitRunIDsMap[commitNum] = append(runs, runID)
+		if runArtifacts[runID] == 0 {
+			commitRunIDsMap[commitNum] = append(commitRunIDsMap[commitNum], runID)
 		}
+		runArtifacts[runID]++
 	}
+	return commitRunIDsMap, runArtifacts, nil
+}
 
-	var pullRequests []pullRequest
-	updatedRunIDs := map[string]struct{}{}
-	for _, pr := range PRs {
-		commitNums, err := c.client.ListCommitsFromPR(ctx, pr.GetNumber())
+// artifactRun returns the commit and run of an unexpired test report artifact of the test suite, ok is false for
+// other artifacts.
+func (c *Commenter) artifactRun(ar *github.Artifact) (commit, runID string, ok bool, err error) {
+	matchTestName, err := regexp.MatchString(c.TestNameMatcher, ar.GetName())
+	if err != nil {
+		return "", "", false, err
+	}
+	if ar.GetExpired() || !matchTestName {
+		return "", "", false, nil
+	}
+	splits := strings.Split(ar.GetName(), "-")
+	if len(splits) < 2 {
+		return "", "", false, nil
+	}
+	return splits[len(splits)-2], splits[len(splits)-1], true, nil
+}
+
+// fullListInterval is how often a watching commenter lists all artifacts again, forgetting the expired and deleted
+// ones, instead of only the new ones.
+const fullListInterval = time.Hour
+
+func (c *Commenter) listArtifacts(ctx context.Context) ([]*github.Artifact, error) {
+	c.listMu.Lock()
+	defer c.listMu.Unlock()
+	if c.artifacts == nil || time.Since(c.listed) > fullListInterval {
+		artifacts, err := c.client.ListAllArtifacts(ctx)
 		if err != nil {
 			return nil, err
 		}
-		var runIDs []string
-		for _, cNum := range commitNums {
-			runIDs = append(runIDs, commitRunIDsMap[cNum]...)
-		}
+		c.artifacts, c.listed = append([]*github.Artifact{}, artifacts...), time.Now()
+		return c.artifacts, nil
+	}
 
-		for _, id := range runIDs {
-			updatedRunIDs[id] = struct{}{}
-		}
-		newRunIds := c.newRunIDs(runIDs)
-		if len(newRunIds) == 0 {
-			continue
+	var since int64
+	for _, ar := range c.artifacts {
+		if ar.GetID() > since {
+			since = ar.GetID()
 		}
+	}
+	artifacts, err := c.client.ListNewArtifacts(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	c.artifacts = append(artifacts, c.artifacts...)
+	return c.artifacts, nil
+}
 
-		pullRequests = append(pullRequests, pullRequest{
-			pr:        pr.GetNumber(),
-			commits:   commitNums,
-			runIDs:    runIDs,
-			newRunIDs: newRunIds,
-		})
+func labelNames(labels []*github.Label) []string {
+	var names []string
+	for _, l := range labels {
+		names = append(names, l.GetName())
 	}
-	c.RunIDs = updatedRunIDs
-	return pullRequests, nil
+	return names
 }
 
-// newRunIDs returns new runs than the commenter listed runIDs.
-func (c *Commenter) newRunIDs(runIDs []string) []string {
+// newRunIDs returns new runs than the commenter listed runIDs. Runs with more test report artifacts than when last
+// reported on were re-run, and their new attempts are new too.
+func (c *Commenter) newRunIDs(runIDs []string, runArtifacts map[string]int) []string {
 	var newIds []string
 	for _, id := range runIDs {
-		if _, ok := c.RunIDs[id]; !ok {
+		if r, ok := c.Runs[id]; !ok || (r.Artifacts > 0 && r.Artifacts < runArtifacts[id]) {
 			newIds = append(newIds, id)
 		}
 	}
@@ -1,22 +1,43 @@
 package commenter
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	fgithub "github.com/operator-framework/flak-analyzer/pkg/github"
+	"github.com/operator-framework/flak-analyzer/pkg/github/fake"
+	"github.com/operator-framework/flak-analyzer/pkg/github/recorder"
 )
 
 const (
 	commenterRepo = "flake-analyzer"
-	token         = ""
 	owner         = "operator-framework"
 	repo          = "operator-lifecycle-manager"
 	testName      = "e2e-test-output"
 )
 
 func TestNewCommenter(t *testing.T) {
-	cf, err := NewCommenter(owner, commenterRepo, token, "flake-bot-operator-fw-artifact", "")
+	mode := recorder.ModeFromEnv()
+	rec, err := recorder.New("./testData/fixtures/new-commenter.yaml", mode, nil)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, rec.Stop()) }()
+
+	dir, err := ioutil.TempDir("", "commenter-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Comments are never posted, so that recording the fixture does not comment on the upstream repository.
+	token := recorder.Token(mode)
+	cf, err := NewCommenter(owner, commenterRepo, token, "flake-bot-operator-fw-artifact",
+		filepath.Join(dir, "commenter_progress_file.yaml"), fgithub.WithTransport(rec),
+		fgithub.WithDryRun(fgithub.NewDryRun(ioutil.Discard, "")))
 	require.NoError(t, err)
 	err = cf.AddRepo(owner, repo, token, testName)
 	require.NoError(t, err)
@@ -26,3 +47,107 @@ func TestNewCommenter(t *testing.T) {
 		fmt.Println(*c)
 	}
 }
+
+// blockingStore saves the progress once released.
+type blockingStore struct {
+	saving, release chan struct{}
+	saved           *Progress
+}
+
+func (s *blockingStore) Load(ctx context.Context) (*Progress, error) {
+	return nil, nil
+}
+
+func (s *blockingStore) Save(ctx context.Context, progress *Progress) error {
+	close(s.saving)
+	<-s.release
+	s.saved = progress
+	return nil
+}
+
+func TestSaveProgressUnlocked(t *testing.T) {
+	store := &blockingStore{saving: make(chan struct{}), release: make(chan struct{})}
+	c := &Commenter{Owner: owner, Repo: repo, Runs: map[string]*RunRecord{"1": {PR: 1}}}
+	f := &CommenterFile{store: store, Commented: []*Commenter{c}}
+	saved := make(chan error)
+	go func() { saved <- f.saveProgress(context.Background()) }()
+
+	// Reports go on while the progress is saved, without changing what is saved.
+	<-store.saving
+	f.mu.Lock()
+	c.Runs["1"].Commented = true
+	c.Runs["2"] = &RunRecord{PR: 1}
+	f.mu.Unlock()
+	close(store.release)
+	require.NoError(t, <-saved)
+	require.Len(t, store.saved.Commented, 1)
+	assert.Equal(t, map[string]*RunRecord{"1": {PR: 1}}, store.saved.Commented[0].Runs)
+}
+
+func TestReloadRepoConfig(t *testing.T) {
+	s := fake.NewServer()
+	defer s.Close()
+	s.AddFile(owner, repo, "master", RepoConfigPath, []byte("suites:\n  - name: e2e\n  - name: unit\n"))
+
+	f := &CommenterFile{options: []fgithub.ClientOption{fgithub.WithEnterpriseURLs(s.URL, "")}}
+	require.NoError(t, f.AddRepo(owner, repo, "token", testName))
+	suites := func() []string {
+		var matchers []string
+		for _, c := range f.commenters(owner, repo) {
+			matchers = append(matchers, c.TestNameMatcher)
+		}
+		return matchers
+	}
+	assert.Equal(t, []string{"e2e", "unit"}, suites())
+
+	// Polls read the configuration file again once stale.
+	s.AddFile(owner, repo, "master", RepoConfigPath, []byte("suites:\n  - name: e2e\n"))
+	f.reloadRepoConfigs(context.Background())
+	assert.Equal(t, []string{"e2e", "unit"}, suites())
+	f.repos[0].loaded = f.repos[0].loaded.Add(-configTTL)
+	f.reloadRepoConfigs(context.Background())
+	assert.Equal(t, []string{"e2e"}, suites())
+	assert.Len(t, f.Commented, 2, "the progress of removed suites is kept")
+
+	// Invalid configuration files are not applied.
+	s.AddFile(owner, repo, "master", RepoConfigPath, []byte("suite: []\n"))
+	f.repos[0].loaded = f.repos[0].loaded.Add(-configTTL)
+	f.reloadRepoConfigs(context.Background())
+	assert.Equal(t, []string{"e2e"}, suites())
+
+	// Pushes reload configuration files right away.
+	s.AddFile(owner, repo, "master", RepoConfigPath, []byte("thresholds:\n  failures: 2\n"))
+	require.NoError(t, f.reloadRepoConfig(context.Background(), owner, repo))
+	assert.Equal(t, []string{testName}, suites())
+	assert.Equal(t, 2, f.commenters(owner, repo)[0].config.Thresholds.Failures)
+}
+
+func TestLoadBaselineOnce(t *testing.T) {
+	s := fake.NewServer()
+	defer s.Close()
+	master := s.AddWorkflowRun(owner, repo, 1, "1af968cb786e652f76cc0d9e5dd7d079bea984cb", "failure")
+	master.HeadBranch = "master"
+
+	f := &CommenterFile{branch: "master", branchDays: 7}
+	c := &Commenter{Owner: owner, Repo: repo, TestNameMatcher: testName, token: "token",
+		options: []fgithub.ClientOption{fgithub.WithEnterpriseURLs(s.URL, "")}}
+	baseline, err := f.loadBaseline(c)
+	require.NoError(t, err)
+	requests := len(s.Requests())
+	require.NotZero(t, requests)
+
+	again, err := f.loadBaseline(c)
+	require.NoError(t, err)
+	assert.Same(t, baseline, again)
+	assert.Len(t, s.Requests(), requests, "the baseline is reused")
+
+	// Baselines are reloaded once stale, or when the repository configures other days.
+	c.baselineLoaded = c.baselineLoaded.Add(-baselineTTL)
+	again, err = f.loadBaseline(c)
+	require.NoError(t, err)
+	assert.NotSame(t, baseline, again)
+	c.config = &RepoConfig{Thresholds: ThresholdConfig{BaselineDays: 14}}
+	baseline, err = f.loadBaseline(c)
+	require.NoError(t, err)
+	assert.NotSame(t, baseline, again)
+}
@@ -0,0 +1,225 @@
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+	fgithub "github.com/operator-framework/flak-analyzer/pkg/github"
+)
+
+// RepoConfigPath is the path of the configuration file analyzed repositories keep on their default branch.
+const RepoConfigPath = ".github/flake-analyzer.yaml"
+
+// RepoConfig lets an analyzed repository tune how its pull requests are reported on. Settings left out fall back to
+// the flags of the commenter.
+type RepoConfig struct {
+	// Suites are the test suites reported on separately, instead of the one given to AddRepo.
+	Suites     []SuiteConfig   `yaml:"suites"`
+	Thresholds ThresholdConfig `yaml:"thresholds"`
+	// Ignore lists the tests left out of reports, e.g. muted with `/flake mute`.
+	Ignore []IgnoredTest `yaml:"ignore"`
+	// Owners are mentioned in reports in which tests they own failed.
+	Owners  []TestOwners  `yaml:"owners"`
+	Comment CommentConfig `yaml:"comment"`
+}
+
+type SuiteConfig struct {
+	Name string `yaml:"name"`
+	// Artifacts is the regular expression the names of the test report artifacts of the suite match in front of
+	// -<commit>-<run ID>. It defaults to the name.
+	Artifacts string `yaml:"artifacts"`
+}
+
+type ThresholdConfig struct {
+	// Failures is the number of failures on a pull request from which a test is reported.
+	Failures int `yaml:"failures"`
+	// BaselineDays is the number of days of baseline branch history failures are classified against.
+	BaselineDays int `yaml:"baseline_days"`
+	// RerunBudget is the number of reruns of known flakes per pull request, zero disables them.
+	RerunBudget *int `yaml:"rerun_budget"`
+}
+
+type IgnoredTest struct {
+	// Test is the name of the test, or its class name and name separated by a slash.
+	Test   string `yaml:"test"`
+	Reason string `yaml:"reason"`
+}
+
+type TestOwners struct {
+	// Tests is a regular expression matching the class name and name of the owned tests, separated by a slash.
+	Tests string `yaml:"tests"`
+	// Users are the GitHub logins of the owners, or teams as <org>/<team>.
+	Users []string `yaml:"users"`
+	tests *regexp.Regexp
+}
+
+type CommentConfig struct {
+	// Template is the name of a built-in comment template, see reporter.LoadTemplate. Custom templates are only read
+	// from the commenter's file system.
+	Template string               `yaml:"template"`
+	Mode     reporter.CommentMode `yaml:"mode"`
+	History  *int                 `yaml:"history"`
+	template *template.Template
+}
+
+// LoadRepoConfig reads the configuration file of the repository of client from its default branch. It returns nil if
+// the repository has none.
+func LoadRepoConfig(ctx context.Context, client *fgithub.RepositoryClient) (*RepoConfig, error) {
+	data, _, err := client.GetFile(ctx, RepoConfigPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s of %s/%s, %v", RepoConfigPath, client.Owner, client.Repo, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	config, err := parseRepoConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s of %s/%s, %v", RepoConfigPath, client.Owner, client.Repo, err)
+	}
+	return config, nil
+}
+
+func parseRepoConfig(data []byte) (*RepoConfig, error) {
+	config := &RepoConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// Misspelled settings would silently fall back to the flags.
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i, s := range config.Suites {
+		if s.Name == "" {
+			return nil, fmt.Errorf("suite %d has no name", i+1)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("suite %s is defined twice", s.Name)
+		}
+		names[s.Name] = true
+		if _, err := regexp.Compile(s.matcher()); err != nil {
+			return nil, fmt.Errorf("invalid artifacts pattern of suite %s, %v", s.Name, err)
+		}
+	}
+	if config.Thresholds.Failures < 0 || config.Thresholds.BaselineDays < 0 ||
+		(config.Thresholds.RerunBudget != nil && *config.Thresholds.RerunBudget < 0) {
+		return nil, fmt.Errorf("thresholds must not be negative")
+	}
+	for i, t := range config.Ignore {
+		if t.Test == "" {
+			return nil, fmt.Errorf("ignored test %d has no name", i+1)
+		}
+	}
+	for i := range config.Owners {
+		o := &config.Owners[i]
+		var err error
+		if o.tests, err = regexp.Compile(o.Tests); err != nil {
+			return nil, fmt.Errorf("invalid tests pattern of owners %s, %v", strings.Join(o.Users, ", "), err)
+		}
+		for j, u := range o.Users {
+			o.Users[j] = strings.TrimPrefix(u, "@")
+		}
+	}
+
+	c := &config.Comment
+	switch c.Template {
+	case "":
+	case reporter.TemplateDetailed, reporter.TemplateCompact, reporter.TemplateMinimal:
+		var err error
+		if c.template, err = reporter.LoadTemplate(c.Template); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown comment template %q, must be one of %s, %s or %s", c.Template,
+			reporter.TemplateDetailed, reporter.TemplateCompact, reporter.TemplateMinimal)
+	}
+	if c.Mode != "" {
+		if _, err := reporter.ParseCommentMode(string(c.Mode)); err != nil {
+			return nil, err
+		}
+	}
+	if c.History != nil && *c.History < 0 {
+		return nil, fmt.Errorf("the comment history must not be negative")
+	}
+	return config, nil
+}
+
+func (s SuiteConfig) matcher() string {
+	if s.Artifacts == "" {
+		return s.Name
+	}
+	return s.Artifacts
+}
+
+// removed tells whether a test is left out of reports, because it is ignored or failed less often than the
+// threshold.
+func (c *RepoConfig) removed(test reporter.TestEntry, failed bool) bool {
+	for _, t := range c.Ignore {
+		if t.Test == test.Name || t.Test == test.ClassName+"/"+test.Name {
+			return true
+		}
+	}
+	return failed && test.Counts < c.Thresholds.Failures
+}
+
+// owners returns the owners of a test.
+func (c *RepoConfig) owners(test reporter.TestEntry) []string {
+	var users []string
+	for _, o := range c.Owners {
+		if o.tests.MatchString(test.ClassName + "/" + test.Name) {
+			users = append(users, o.Users...)
+		}
+	}
+	return users
+}
+
+// baselineDays returns the number of days of baseline history the failures of c are classified against.
+func (f *CommenterFile) baselineDays(c *Commenter) int {
+	if c.config != nil && c.config.Thresholds.BaselineDays > 0 {
+		return c.config.Thresholds.BaselineDays
+	}
+	return f.branchDays
+}
+
+// rerunBudgetOf returns the number of reruns of known flakes per pull request of c.
+func (f *CommenterFile) rerunBudgetOf(c *Commenter) int {
+	if c.config != nil && c.config.Thresholds.RerunBudget != nil {
+		return *c.config.Thresholds.RerunBudget
+	}
+	return f.rerunBudget
+}
+
+// postReport posts the report on a pull request of c as a comment, styled as configured by the repository.
+func (f *CommenterFile) postReport(ctx context.Context, c *Commenter, report *reporter.FlakeReport) (*string, error) {
+	login, err := c.client.Login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mode, history, t := f.commentMode, f.history, f.template
+	var owners func(reporter.TestEntry) []string
+	if c.config != nil {
+		if c.config.Comment.Mode != "" {
+			mode = c.config.Comment.Mode
+		}
+		if c.config.Comment.History != nil {
+			history = *c.config.Comment.History
+		}
+		if c.config.Comment.template != nil {
+			t = c.config.Comment.template
+		}
+		if len(c.config.Owners) > 0 {
+			owners = c.config.owners
+		}
+	}
+	return report.PostReportAsPullRequestComment(reporter.WithCommentMode(mode), reporter.WithCommentHistory(history),
+		reporter.WithCommentTemplate(t), reporter.WithTestOwners(owners),
+		reporter.WithClientOptions(fgithub.WithLogin(login)))
+}
@@ -0,0 +1,61 @@
+package commenter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+)
+
+func TestParseRepoConfig(t *testing.T) {
+	config, err := parseRepoConfig([]byte(`suites:
+  - name: e2e
+  - name: unit
+    artifacts: unit-.*
+thresholds:
+  failures: 2
+  rerun_budget: 0
+ignore:
+  - test: e2e/flake
+    reason: Muted in #1641
+owners:
+  - tests: ^e2e/
+    users: ["@alice", "org/team"]
+comment:
+  template: minimal
+  mode: minimize
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "e2e", config.Suites[0].matcher())
+	assert.Equal(t, "unit-.*", config.Suites[1].matcher())
+	assert.Equal(t, []string{"alice", "org/team"}, config.owners(reporter.TestEntry{ClassName: "e2e", Name: "install"}))
+	assert.Empty(t, config.owners(reporter.TestEntry{ClassName: "unit", Name: "parse"}))
+	assert.True(t, config.removed(reporter.TestEntry{ClassName: "e2e", Name: "flake", Counts: 5}, true))
+	assert.True(t, config.removed(reporter.TestEntry{ClassName: "e2e", Name: "install", Counts: 1}, true))
+	assert.False(t, config.removed(reporter.TestEntry{ClassName: "e2e", Name: "install", Counts: 1}, false))
+	assert.False(t, config.removed(reporter.TestEntry{ClassName: "e2e", Name: "install", Counts: 2}, true))
+
+	f := &CommenterFile{rerunBudget: 3, branchDays: 7}
+	c := &Commenter{config: config}
+	assert.Equal(t, 0, f.rerunBudgetOf(c))
+	assert.Equal(t, 7, f.baselineDays(c))
+
+	for _, invalid := range []string{
+		"suite:\n  - name: e2e\n",
+		"suites:\n  - artifacts: e2e\n",
+		"suites:\n  - name: e2e\n  - name: e2e\n",
+		"thresholds:\n  failures: -1\n",
+		"owners:\n  - tests: \"(\"\n",
+		"comment:\n  template: ./custom.tmpl\n",
+		"comment:\n  mode: sticky\n",
+	} {
+		_, err := parseRepoConfig([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+
+	config, err = parseRepoConfig(nil)
+	require.NoError(t, err)
+	assert.Empty(t, config.Suites)
+}
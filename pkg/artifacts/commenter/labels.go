@@ -0,0 +1,92 @@
+package commenter
+
+import (
+	"context"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+)
+
+// PRLabels names the labels set on pull requests according to how the failures on their head commit are classified.
+// At most one of them is set at a time, and all of them are removed once the runs on the head pass.
+type PRLabels struct {
+	// Flaky is set when all failed tests are known flakes.
+	Flaky string
+	// Broken is set when runs failed without any failed test, e.g. on a build or setup error.
+	Broken string
+	// Investigate is set when tests are new failures or failed with new errors.
+	Investigate string
+}
+
+func DefaultPRLabels() *PRLabels {
+	return &PRLabels{
+		Flaky:       "flaky-ci",
+		Broken:      "ci-broken",
+		Investigate: "needs-investigation",
+	}
+}
+
+// SetPRLabels labels pull requests according to the classification of their latest failures. It requires a
+// baseline, see SetBaseline. Nil labels disable labeling.
+func (f *CommenterFile) SetPRLabels(labels *PRLabels) {
+	f.labels = labels
+}
+
+// prLabel returns the label the runs on the pull request head call for, or an empty string if they passed. It
+// returns false if no run on the head completed since the last poll.
+func (l *PRLabels) prLabel(pr pullRequest, report *reporter.FlakeReport, runs []*github.WorkflowRun) (string, bool) {
+	completed, failed := false, false
+	for _, run := range runs {
+		if run.GetHeadSHA() != pr.head {
+			continue
+		}
+		completed = true
+		failed = failed || run.GetConclusion() == "failure"
+	}
+	if !completed || !failed {
+		return "", completed
+	}
+
+	failures := report.FailuresOn(pr.head)
+	switch {
+	case len(failures) == 0:
+		return l.Broken, true
+	case len(failures[reporter.NewFailure]) > 0 || len(failures[reporter.KnownTestNewError]) > 0:
+		return l.Investigate, true
+	default:
+		return l.Flaky, true
+	}
+}
+
+// labelPR sets the label the new runs on the pull request head call for and removes the other ones. The report is
+// only used if runs failed.
+func (f *CommenterFile) labelPR(ctx context.Context, c *Commenter, pr pullRequest, report *reporter.FlakeReport,
+	runs []*github.WorkflowRun) error {
+	want, ok := f.labels.prLabel(pr, report, runs)
+	if !ok {
+		return nil
+	}
+
+	present := map[string]bool{}
+	for _, l := range pr.labels {
+		present[l] = true
+	}
+	for _, l := range []string{f.labels.Flaky, f.labels.Broken, f.labels.Investigate} {
+		if l == "" || l == want || !present[l] {
+			continue
+		}
+		if err := c.client.RemoveLabel(ctx, pr.pr, l); err != nil {
+			return err
+		}
+		logrus.Infof("Removed label %s from pull request #%d", l, pr.pr)
+	}
+	if want != "" && !present[want] {
+		if err := c.client.AddLabels(ctx, pr.pr, want); err != nil {
+			return err
+		}
+		logrus.Infof("Labeled pull request #%d as %s", pr.pr, want)
+	}
+	return nil
+}
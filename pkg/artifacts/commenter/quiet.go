@@ -0,0 +1,123 @@
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+)
+
+// QuietPolicy holds back reports on pull requests to keep the commenter from flooding them with comments. Held back
+// runs are not recorded as reported on, they are reported on by a later poll or webhook once the policy allows it.
+// Slash commands are run regardless.
+type QuietPolicy struct {
+	// WaitForRuns holds back reports until all workflow runs on the head commit of the pull request completed, e.g.
+	// all jobs of a matrix.
+	WaitForRuns bool
+	// MinInterval is the minimum time between two report comments on a pull request.
+	MinInterval time.Duration
+	// SkipDrafts does not report on draft pull requests until they are ready for review.
+	SkipDrafts bool
+	// OptOutLabels are the labels of pull requests not to report on.
+	OptOutLabels []string
+	// MaxPRs is the number of pull requests with failed runs reported on per GenerateComments at most, e.g. to avoid a
+	// storm of notifications after an infrastructure outage failed all runs. Zero is unlimited. Webhooks are not
+	// capped.
+	MaxPRs int
+}
+
+// DefaultQuietPolicy only holds back reports on pull requests labeled no-flake-bot.
+func DefaultQuietPolicy() QuietPolicy {
+	return QuietPolicy{OptOutLabels: []string{"no-flake-bot"}}
+}
+
+// SetQuietPolicy holds back reports on pull requests according to policy. Nothing is held back by default.
+func (f *CommenterFile) SetQuietPolicy(policy QuietPolicy) {
+	f.quiet = policy
+}
+
+// errCapped is returned when reporting on a pull request would exceed QuietPolicy.MaxPRs.
+var errCapped = errors.New("the maximum number of pull requests reported on per poll is reached")
+
+// holdBack returns why the report on the new runs of a pull request is held back, or an empty string if it is not.
+// QuietPolicy.MaxPRs is only checked once the runs are known to have failed, see reserveReport.
+func (f *CommenterFile) holdBack(ctx context.Context, c *Commenter, prc pullRequest) (string, error) {
+	for _, label := range prc.labels {
+		for _, optOut := range f.quiet.OptOutLabels {
+			if strings.EqualFold(label, optOut) {
+				return fmt.Sprintf("it is labeled %s", label), nil
+			}
+		}
+	}
+	if f.quiet.SkipDrafts && prc.draft {
+		return "it is a draft", nil
+	}
+	if f.commentWait(c, prc.pr) > 0 {
+		return fmt.Sprintf("it was commented on less than %s ago", f.quiet.MinInterval), nil
+	}
+	if f.quiet.WaitForRuns && prc.head != "" {
+		runs, err := c.client.ListCommitRuns(ctx, prc.head)
+		if err != nil {
+			return "", err
+		}
+		var pending int
+		for _, run := range runs {
+			if run.GetStatus() != "completed" {
+				pending++
+			}
+		}
+		if pending > 0 {
+			return fmt.Sprintf("%s on its head %s did not complete yet", reporter.Plural(pending, "run", "runs"), prc.head), nil
+		}
+	}
+	return "", nil
+}
+
+// reserveReport counts a pull request with failed runs against QuietPolicy.MaxPRs, and returns false if the maximum
+// was reached.
+func (f *CommenterFile) reserveReport() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.quiet.MaxPRs > 0 && f.reportedPRs >= f.quiet.MaxPRs {
+		return false
+	}
+	f.reportedPRs++
+	return true
+}
+
+// commentWait returns how long until QuietPolicy.MinInterval allows another report comment on a pull request, zero if
+// it does now.
+func (f *CommenterFile) commentWait(c *Commenter, pr int) time.Duration {
+	if f.quiet.MinInterval <= 0 {
+		return 0
+	}
+	f.mu.Lock()
+	last := c.lastComment(pr)
+	f.mu.Unlock()
+	if wait := f.quiet.MinInterval - time.Since(last); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// lastComment returns when a report comment was last posted or updated on a pull request, zero if none was. Runs
+// recorded before the comment time was kept fall back to when they were first reported on.
+func (c *Commenter) lastComment(pr int) time.Time {
+	var last time.Time
+	for _, r := range c.Runs {
+		if r.PR != pr || !r.Commented {
+			continue
+		}
+		at := r.FirstSeen
+		if r.CommentedAt != nil {
+			at = *r.CommentedAt
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	return last
+}
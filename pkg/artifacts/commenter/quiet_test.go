@@ -0,0 +1,65 @@
+package commenter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHoldBack(t *testing.T) {
+	f := &CommenterFile{}
+	f.SetQuietPolicy(QuietPolicy{MinInterval: time.Hour, SkipDrafts: true, OptOutLabels: []string{"no-flake-bot"},
+		MaxPRs: 1})
+	c := &Commenter{Owner: owner, Repo: repo}
+	ctx := context.Background()
+
+	reason, err := f.holdBack(ctx, c, pullRequest{pr: 1, labels: []string{"No-Flake-Bot"}})
+	require.NoError(t, err)
+	assert.Equal(t, "it is labeled No-Flake-Bot", reason)
+	reason, err = f.holdBack(ctx, c, pullRequest{pr: 1, draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, "it is a draft", reason)
+	reason, err = f.holdBack(ctx, c, pullRequest{pr: 1})
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Runs recorded without a comment do not count as a comment.
+	c.recordRuns(pullRequest{pr: 1, newRunIDs: []string{"1"}}, 0, time.Now())
+	reason, err = f.holdBack(ctx, c, pullRequest{pr: 1})
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+	c.recordRuns(pullRequest{pr: 1, newRunIDs: []string{"2"}}, 42, time.Now().Add(-time.Minute))
+	reason, err = f.holdBack(ctx, c, pullRequest{pr: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "it was commented on less than 1h0m0s ago", reason)
+	reason, err = f.holdBack(ctx, c, pullRequest{pr: 2})
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	assert.True(t, f.reserveReport())
+	assert.False(t, f.reserveReport())
+}
+
+func TestLastComment(t *testing.T) {
+	now := time.Now()
+	c := &Commenter{Owner: owner, Repo: repo}
+	assert.True(t, c.lastComment(1).IsZero())
+
+	// Runs recorded before the comment time was kept fall back to when they were first seen.
+	c.Runs = map[string]*RunRecord{"1": {PR: 1, FirstSeen: now.Add(-2 * time.Hour), Commented: true}}
+	assert.Equal(t, now.Add(-2*time.Hour), c.lastComment(1))
+
+	// Reporting again on a run already seen, e.g. for /flake report or by updating a sticky comment, bumps the time.
+	c.recordRuns(pullRequest{pr: 1, newRunIDs: []string{"1"}}, 42, now.Add(-time.Minute))
+	assert.Equal(t, now.Add(-2*time.Hour), c.Runs["1"].FirstSeen)
+	assert.Equal(t, now.Add(-time.Minute), c.lastComment(1))
+
+	f := &CommenterFile{}
+	f.SetQuietPolicy(QuietPolicy{MinInterval: time.Hour})
+	wait := f.commentWait(c, 1)
+	assert.True(t, wait > 58*time.Minute && wait <= 59*time.Minute, wait)
+	assert.Zero(t, f.commentWait(c, 2))
+}
@@ -0,0 +1,169 @@
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ReposConfig lists the repositories a commenter comments on.
+type ReposConfig struct {
+	Repos []RepoEntry `yaml:"repos"`
+}
+
+// RepoEntry is a repository to comment on, with its test suites and credentials.
+type RepoEntry struct {
+	Owner string `yaml:"owner"`
+	Repo  string `yaml:"repo"`
+	// Suites are the test suite filters of the repository, all its artifacts by default.
+	Suites []string `yaml:"suites"`
+	// TokenEnv is the environment variable holding the token of the repository.
+	TokenEnv string `yaml:"token_env"`
+	// TokenFile is the file holding the token of the repository.
+	TokenFile string `yaml:"token_file"`
+}
+
+// LoadReposConfig reads the repositories to comment on from a YAML file.
+func LoadReposConfig(path string) (*ReposConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &ReposConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid repositories config %s, %v", path, err)
+	}
+	seen := map[string]bool{}
+	for i, r := range config.Repos {
+		if r.Owner == "" || r.Repo == "" {
+			return nil, fmt.Errorf("repository %d of %s has no owner or name", i+1, path)
+		}
+		if r.TokenEnv != "" && r.TokenFile != "" {
+			return nil, fmt.Errorf("repository %s/%s of %s has both a token_env and a token_file", r.Owner, r.Repo,
+				path)
+		}
+		key := strings.ToLower(r.Owner + "/" + r.Repo)
+		if seen[key] {
+			return nil, fmt.Errorf("repository %s/%s is listed twice in %s", r.Owner, r.Repo, path)
+		}
+		seen[key] = true
+	}
+	return config, nil
+}
+
+// Token returns the token of the repository from its token_env or token_file, or an empty string if it has neither.
+func (r RepoEntry) Token() (string, error) {
+	if r.TokenEnv != "" {
+		token := os.Getenv(r.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("the token variable %s of %s/%s is not set", r.TokenEnv, r.Owner, r.Repo)
+		}
+		return token, nil
+	}
+	if r.TokenFile != "" {
+		data, err := ioutil.ReadFile(r.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the token file of %s/%s, %v", r.Owner, r.Repo, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
+
+// RepoResult is the outcome of commenting on the pull requests of a repository.
+type RepoResult struct {
+	Owner, Repo string
+	// Suites is the number of test suites commented on.
+	Suites int
+	// PullRequests is the number of open pull requests, Reported the number of those with new runs reported on.
+	PullRequests int
+	Reported     int
+	// Comments is the number of report comments posted.
+	Comments int
+	// HeldBack is the number of reports held back by the quiet policy, see SetQuietPolicy.
+	HeldBack int
+	// Summarized is the number of merged or closed pull requests summarized, see SetPRSummaries.
+	Summarized int
+	Err        error
+}
+
+// SetConcurrency comments on at most n repositories at a time. Repositories are commented on one at a time by
+// default.
+func (f *CommenterFile) SetConcurrency(n int) {
+	f.concurrency = n
+}
+
+// Results returns the outcome of the last GenerateComments per repository, in the order the repositories were
+// added.
+func (f *CommenterFile) Results() []RepoResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]RepoResult(nil), f.results...)
+}
+
+// generateAllComments comments on the repositories concurrently. A repository failing does not stop the others, its
+// runs are reported on by the next poll.
+func (f *CommenterFile) generateAllComments(ctx context.Context) ([]*string, error) {
+	f.reloadRepoConfigs(ctx)
+
+	var repos [][]*Commenter
+	index := map[string]int{}
+	f.mu.Lock()
+	for _, c := range f.Commented {
+		if !c.active {
+			continue
+		}
+		key := strings.ToLower(c.Owner + "/" + c.Repo)
+		i, ok := index[key]
+		if !ok {
+			i = len(repos)
+			index[key] = i
+			repos = append(repos, nil)
+		}
+		repos[i] = append(repos[i], c)
+	}
+	f.reportedPRs = 0
+	f.mu.Unlock()
+
+	concurrency := f.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	results := make([]RepoResult, len(repos))
+	comments := make([][]*string, len(repos))
+	var wg sync.WaitGroup
+	for i, commenters := range repos {
+		wg.Add(1)
+		go func(i int, commenters []*Commenter) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			comments[i], results[i] = f.generateRepoComments(ctx, commenters)
+		}(i, commenters)
+	}
+	wg.Wait()
+
+	var all []*string
+	var errs []error
+	for i, r := range results {
+		all = append(all, comments[i]...)
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %v", r.Owner, r.Repo, r.Err))
+		}
+	}
+	f.mu.Lock()
+	f.results = results
+	f.mu.Unlock()
+	return all, utilerrors.NewAggregate(errs)
+}
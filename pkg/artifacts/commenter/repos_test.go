@@ -0,0 +1,58 @@
+package commenter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadReposConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repos-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(content string) string {
+		path := filepath.Join(dir, "repos.yaml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600))
+	os.Setenv("REPOS_TEST_TOKEN", "env-token")
+	defer os.Unsetenv("REPOS_TEST_TOKEN")
+
+	config, err := LoadReposConfig(write(`repos:
+  - owner: operator-framework
+    repo: operator-lifecycle-manager
+    suites: [e2e, unit]
+    token_env: REPOS_TEST_TOKEN
+  - owner: operator-framework
+    repo: operator-registry
+    token_file: ` + tokenFile + `
+  - owner: operator-framework
+    repo: api
+`))
+	require.NoError(t, err)
+	require.Len(t, config.Repos, 3)
+	assert.Equal(t, []string{"e2e", "unit"}, config.Repos[0].Suites)
+	for i, expected := range []string{"env-token", "file-token", ""} {
+		token, err := config.Repos[i].Token()
+		require.NoError(t, err)
+		assert.Equal(t, expected, token)
+	}
+
+	_, err = RepoEntry{Owner: "o", Repo: "r", TokenEnv: "REPOS_TEST_UNSET"}.Token()
+	assert.Error(t, err)
+	for _, invalid := range []string{
+		"repos:\n  - owner: o\n",
+		"repos:\n  - owner: o\n    repo: r\n  - owner: O\n    repo: R\n",
+		"repos:\n  - owner: o\n    repo: r\n    token_env: T\n    token_file: t\n",
+		"repositories:\n  - owner: o\n    repo: r\n",
+	} {
+		_, err := LoadReposConfig(write(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
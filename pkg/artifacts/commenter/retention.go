@@ -0,0 +1,139 @@
+package commenter
+
+import (
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRetention is how long the runs of closed pull requests are kept in the progress by default.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// runExpiries returns when the artifacts of the runs with unexpired test report artifacts of the test suite expire,
+// by run ID. The expiry is zero if GitHub does not tell.
+func (c *Commenter) runExpiries(artifacts []*github.Artifact) (map[string]time.Time, error) {
+	expiries := map[string]time.Time{}
+	for _, ar := range artifacts {
+		_, runID, ok, err := c.artifactRun(ar)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		// Runs expire with their first artifact to expire.
+		expires, seen := expiries[runID]
+		if !seen || (ar.ExpiresAt != nil && (expires.IsZero() || ar.GetExpiresAt().Before(expires))) {
+			expiries[runID] = ar.GetExpiresAt().Time
+		}
+	}
+	return expiries, nil
+}
+
+// recordRuns records the new runs of a pull request once reported on, along with the ID of the report comment if one
+// was posted.
+func (c *Commenter) recordRuns(prc pullRequest, commentID int64, now time.Time) {
+	if c.Runs == nil {
+		c.Runs = map[string]*RunRecord{}
+	}
+	for _, id := range prc.newRunIDs {
+		r, ok := c.Runs[id]
+		if !ok {
+			r = &RunRecord{FirstSeen: now}
+			c.Runs[id] = r
+		}
+		r.PR, r.Commit, r.Closed = prc.pr, prc.runCommits[id], nil
+		if n := prc.runArtifacts[id]; n > 0 {
+			r.Artifacts = n
+		}
+		if commentID != 0 {
+			r.Commented, r.CommentID, r.CommentedAt = true, commentID, &now
+		}
+	}
+}
+
+// openRuns marks the recorded runs of an open pull request as open, and returns whether some were closed, i.e. the
+// pull request was reopened. Runs recorded without their number of artifacts get it.
+func (c *Commenter) openRuns(prc pullRequest) bool {
+	var reopened bool
+	for _, id := range prc.runIDs {
+		if r, ok := c.Runs[id]; ok {
+			reopened = reopened || r.Closed != nil
+			r.PR, r.Commit, r.Closed = prc.pr, prc.runCommits[id], nil
+			if r.Artifacts == 0 {
+				r.Artifacts = prc.runArtifacts[id]
+			}
+		}
+	}
+	return reopened
+}
+
+// closeRuns marks the recorded runs of a pull request as closed.
+func (c *Commenter) closeRuns(pr int, now time.Time) {
+	for _, r := range c.Runs {
+		if r.PR == pr && r.Closed == nil {
+			r.Closed = &now
+		}
+	}
+}
+
+// retainRuns updates the recorded runs after a poll of the open pull requests prcs, and prunes them, see pruneRuns.
+// Runs missing from expiries have no unexpired artifacts left and are pruned too.
+func (c *Commenter) retainRuns(prcs []pullRequest, expiries map[string]time.Time, now time.Time,
+	retention time.Duration) {
+	open := map[string]bool{}
+	for _, prc := range prcs {
+		c.openRuns(prc)
+		for _, id := range prc.runIDs {
+			open[id] = true
+		}
+	}
+	for id, r := range c.Runs {
+		expires, ok := expiries[id]
+		if !ok {
+			expires = now
+		}
+		if !expires.IsZero() {
+			r.ExpiresAt = &expires
+		}
+		if !open[id] && r.Closed == nil {
+			r.Closed = &now
+		}
+	}
+	c.pruneRuns(now, retention)
+}
+
+// pruneRuns forgets the runs whose artifacts expired, and the runs of pull requests closed for longer than the
+// retention.
+func (c *Commenter) pruneRuns(now time.Time, retention time.Duration) {
+	var pruned int
+	for id, r := range c.Runs {
+		if (r.ExpiresAt != nil && !r.ExpiresAt.After(now)) || (r.Closed != nil && !r.Closed.Add(retention).After(now)) {
+			delete(c.Runs, id)
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		logrus.Infof("Pruned %d runs of closed pull requests or with expired artifacts of %s/%s from the progress",
+			pruned, c.Owner, c.Repo)
+	}
+}
+
+// migrateRunIDs moves the runs of progress of version 1 to Runs. Their pull requests and commits are filled in by the
+// next poll.
+func (c *Commenter) migrateRunIDs(now time.Time) {
+	if len(c.RunIDs) == 0 {
+		c.RunIDs = nil
+		return
+	}
+	if c.Runs == nil {
+		c.Runs = map[string]*RunRecord{}
+	}
+	for id := range c.RunIDs {
+		if _, ok := c.Runs[id]; !ok {
+			c.Runs[id] = &RunRecord{FirstSeen: now}
+		}
+	}
+	c.RunIDs = nil
+}
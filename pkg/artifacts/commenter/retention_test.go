@@ -0,0 +1,43 @@
+package commenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetainRuns(t *testing.T) {
+	now := time.Now()
+	c := &Commenter{Owner: owner, Repo: repo}
+	prc := pullRequest{pr: 1, runIDs: []string{"1", "2"}, newRunIDs: []string{"1", "2"},
+		runCommits: map[string]string{"1": "a", "2": "b"}}
+	c.recordRuns(prc, 42, now)
+	c.recordRuns(pullRequest{pr: 2, runIDs: []string{"3"}, newRunIDs: []string{"3"}}, 0, now)
+	require.Len(t, c.Runs, 3)
+	assert.Equal(t, RunRecord{PR: 1, Commit: "b", FirstSeen: now, Commented: true, CommentID: 42,
+		CommentedAt: &now}, *c.Runs["2"])
+	assert.False(t, c.Runs["3"].Commented)
+
+	// Pull request 2 is closed, and the artifacts of run 1 expired.
+	expires := now.Add(time.Hour)
+	expiries := map[string]time.Time{"2": expires, "3": expires}
+	c.retainRuns([]pullRequest{prc}, expiries, now, time.Hour)
+	require.Len(t, c.Runs, 2)
+	assert.Equal(t, expires, *c.Runs["2"].ExpiresAt)
+	assert.Nil(t, c.Runs["2"].Closed)
+	require.NotNil(t, c.Runs["3"].Closed)
+
+	// Reopening the pull request within the retention keeps its runs.
+	assert.True(t, c.openRuns(pullRequest{pr: 2, runIDs: []string{"3"}}))
+	assert.Nil(t, c.Runs["3"].Closed)
+
+	c.closeRuns(2, now)
+	c.retainRuns([]pullRequest{prc}, expiries, now.Add(time.Hour-time.Minute), time.Hour)
+	assert.Contains(t, c.Runs, "3")
+	c.retainRuns([]pullRequest{prc}, expiries, now.Add(time.Hour), time.Hour)
+	assert.NotContains(t, c.Runs, "3")
+	// Run 2 expired meanwhile.
+	assert.Empty(t, c.Runs)
+}
@@ -0,0 +1,457 @@
+package commenter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+	fgithub "github.com/operator-framework/flak-analyzer/pkg/github"
+)
+
+// ProgressVersion is the version of the progress schema written by this commenter. Progress without a version was
+// written before the schema was versioned and is read as version 1. Version 2 replaced the run IDs reported on with
+// records of the runs, see RunRecord.
+const ProgressVersion = 2
+
+// Progress is what the commenter remembers between runs: the runs already reported on and the reruns triggered per
+// analyzed repository. Older versions are migrated when loaded.
+type Progress struct {
+	Version   int          `json:"version"`
+	Commented []*Commenter `json:"commented"`
+}
+
+func (p *Progress) check() error {
+	if p.Version > ProgressVersion {
+		return fmt.Errorf("progress schema version %d is newer than the supported version %d, upgrade the commenter",
+			p.Version, ProgressVersion)
+	}
+	if p.Version < 2 {
+		now := time.Now()
+		for _, c := range p.Commented {
+			c.migrateRunIDs(now)
+		}
+	}
+	p.Version = ProgressVersion
+	return nil
+}
+
+// ProgressStore persists the progress of the commenter.
+type ProgressStore interface {
+	// Load returns the saved progress, or nil if nothing was saved yet.
+	Load(ctx context.Context) (*Progress, error)
+	// Save replaces the saved progress.
+	Save(ctx context.Context, progress *Progress) error
+}
+
+// SummaryStore is implemented by stores that keep the summaries of merged and closed pull requests next to the
+// progress, see SetPRSummaries.
+type SummaryStore interface {
+	// SaveSummary saves a summary in YAML under a file name, replacing an earlier summary of the same name.
+	SaveSummary(ctx context.Context, name string, data []byte) error
+}
+
+// summaryDir is the directory next to the progress file that pull request summaries are saved to.
+const summaryDir = "pr-summaries"
+
+// Locker is implemented by stores that can keep other commenters from using the progress while it is being updated.
+type Locker interface {
+	// Lock waits until the progress is not used by another commenter and returns the function that releases it.
+	Lock(ctx context.Context) (func() error, error)
+}
+
+func decodeYAML(data []byte) (*Progress, error) {
+	progress := &Progress{}
+	if err := yaml.Unmarshal(data, progress); err != nil {
+		return nil, err
+	}
+	return progress, progress.check()
+}
+
+func decodeJSON(data []byte) (*Progress, error) {
+	progress := &Progress{}
+	if err := json.Unmarshal(data, progress); err != nil {
+		return nil, err
+	}
+	return progress, progress.check()
+}
+
+const (
+	// lockRetryInterval is how often a FileStore retries to take a lock held by another commenter.
+	lockRetryInterval = time.Second
+	// staleLockAge is the age from which a lock is considered left behind by a commenter that did not terminate
+	// properly and is broken.
+	staleLockAge = time.Hour
+)
+
+// lockRefreshInterval is how often a FileStore touches the lock it holds, so that commenters watching or serving
+// webhooks for longer than staleLockAge keep it.
+var lockRefreshInterval = staleLockAge / 4
+
+// FileStore keeps the progress in a local YAML file. Files are replaced atomically, and commenters sharing the file
+// serialize on a lock file next to it.
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Load(ctx context.Context) (*Progress, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeYAML(data)
+}
+
+func (s *FileStore) Save(ctx context.Context, progress *Progress) error {
+	data, err := yaml.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it over the progress, so that readers never see a partial file.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	logrus.Infof("Commenter progress file saved as %s", s.path)
+	return nil
+}
+
+// SaveSummary writes the summary to the pr-summaries directory next to the progress file.
+func (s *FileStore) SaveSummary(ctx context.Context, name string, data []byte) error {
+	dir := filepath.Join(filepath.Dir(s.path), summaryDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		return err
+	}
+	logrus.Infof("Pull request summary saved as %s", file)
+	return nil
+}
+
+// Lock creates the lock file <path>.lock, waiting for other commenters to remove it. The lock file is touched while
+// it is held, lock files untouched for an hour are considered stale and broken.
+func (s *FileStore) Lock(ctx context.Context) (func() error, error) {
+	lock := s.path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0700); err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			stop, stopped := make(chan struct{}), make(chan struct{})
+			go refreshLock(lock, stop, stopped)
+			return func() error {
+				close(stop)
+				<-stopped
+				return os.Remove(lock)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			logrus.Warnf("Breaking stale lock %s of %s", lock, info.ModTime())
+			os.Remove(lock)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to lock %s, %v", s.path, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// refreshLock touches the lock file every lockRefreshInterval until stop is closed, then closes stopped.
+func refreshLock(lock string, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if err := os.Chtimes(lock, now, now); err != nil {
+				logrus.Warnf("Failed to refresh lock %s, %v", lock, err)
+			}
+		}
+	}
+}
+
+// ArtifactStore loads the progress from the newest GitHub Actions artifact of a name in the analyzer repository, and
+// saves it to a local file the workflow uploads as the next artifact. Progress is lost, and runs are commented on
+// again, if the upload fails.
+type ArtifactStore struct {
+	client *fgithub.RepositoryClient
+	name   string
+	file   *FileStore
+}
+
+// NewArtifactStore returns a store reading the artifact called name. The progress is saved to file, by default
+// ./commenter_progress_file.yaml.
+func NewArtifactStore(client *fgithub.RepositoryClient, name, file string) *ArtifactStore {
+	if file == "" {
+		file = "./commenter_progress_file.yaml"
+	}
+	return &ArtifactStore{client: client, name: name, file: NewFileStore(file)}
+}
+
+func (s *ArtifactStore) Load(ctx context.Context) (*Progress, error) {
+	artifacts, err := s.client.ListAllArtifacts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].GetCreatedAt().Time.After(artifacts[j].GetCreatedAt().Time)
+	})
+
+	for _, ar := range artifacts {
+		if ar.GetName() != s.name {
+			continue
+		}
+		dir, err := ioutil.TempDir("./", "commenter-progress-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+
+		if _, err = s.client.DownloadArtifacts(ctx, []*github.Artifact{ar}, dir, "", nil, nil); err != nil {
+			return nil, err
+		}
+		content, err := reporter.Unzip(filepath.Join(dir, ar.GetName()+".zip"))
+		if err != nil {
+			return nil, err
+		}
+		return decodeYAML(content)
+	}
+	return nil, nil
+}
+
+func (s *ArtifactStore) Save(ctx context.Context, progress *Progress) error {
+	return s.file.Save(ctx, progress)
+}
+
+// SaveSummary writes the summary next to the progress file, for the workflow to upload along with it.
+func (s *ArtifactStore) SaveSummary(ctx context.Context, name string, data []byte) error {
+	return s.file.SaveSummary(ctx, name, data)
+}
+
+// BranchStore keeps the progress as a JSON file on a dedicated branch of the analyzer repository, committed through
+// the contents API. Concurrent updates are detected by GitHub and fail instead of overwriting each other.
+type BranchStore struct {
+	client *fgithub.RepositoryClient
+	branch string
+	path   string
+	sha    string
+}
+
+// NewBranchStore returns a store keeping the progress at path on branch. The branch is created from the default
+// branch on the first save.
+func NewBranchStore(client *fgithub.RepositoryClient, branch, path string) *BranchStore {
+	if path == "" {
+		path = "commenter-progress.json"
+	}
+	return &BranchStore{client: client, branch: branch, path: path}
+}
+
+func (s *BranchStore) Load(ctx context.Context) (*Progress, error) {
+	data, sha, err := s.client.GetFile(ctx, s.path, s.branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from branch %s, %v", s.path, s.branch, err)
+	}
+	s.sha = sha
+	if data == nil {
+		return nil, nil
+	}
+	return decodeJSON(data)
+}
+
+func (s *BranchStore) Save(ctx context.Context, progress *Progress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.sha == "" {
+		if err := s.client.EnsureBranch(ctx, s.branch); err != nil {
+			return err
+		}
+	}
+	sha, err := s.client.PutFile(ctx, s.path, s.branch, s.sha, "Update flake analyzer commenter progress", data)
+	if err != nil {
+		return fmt.Errorf("failed to commit %s to branch %s, %v", s.path, s.branch, err)
+	}
+	s.sha = sha
+	logrus.Infof("Commenter progress saved to %s on branch %s", s.path, s.branch)
+	return nil
+}
+
+// SaveSummary commits the summary to the pr-summaries directory next to the progress file on the branch.
+func (s *BranchStore) SaveSummary(ctx context.Context, name string, data []byte) error {
+	file := path.Join(path.Dir(s.path), summaryDir, name)
+	if s.sha == "" {
+		if err := s.client.EnsureBranch(ctx, s.branch); err != nil {
+			return err
+		}
+	}
+	_, sha, err := s.client.GetFile(ctx, file, s.branch)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from branch %s, %v", file, s.branch, err)
+	}
+	if _, err := s.client.PutFile(ctx, file, s.branch, sha, "Add flake analyzer pull request summary",
+		data); err != nil {
+		return fmt.Errorf("failed to commit %s to branch %s, %v", file, s.branch, err)
+	}
+	logrus.Infof("Pull request summary saved to %s on branch %s", file, s.branch)
+	return nil
+}
+
+const progressIssueHeader = "This issue stores the progress of the flake analyzer commenter, do not edit it.\n\n"
+
+var progressBlock = regexp.MustCompile("(?s)```json\n(.*)\n```")
+
+// maxIssueBodySize is the length limit of issue bodies in characters.
+const maxIssueBodySize = 65536
+
+// IssueStore keeps the progress as JSON in the body of an issue of the analyzer repository. Issue bodies are limited
+// to maxIssueBodySize characters, the branch and gist stores suit progress of many runs better.
+type IssueStore struct {
+	client *fgithub.RepositoryClient
+	number int
+}
+
+func NewIssueStore(client *fgithub.RepositoryClient, number int) *IssueStore {
+	return &IssueStore{client: client, number: number}
+}
+
+func (s *IssueStore) Load(ctx context.Context) (*Progress, error) {
+	issue, err := s.client.GetIssue(ctx, s.number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issue #%d, %v", s.number, err)
+	}
+	match := progressBlock.FindStringSubmatch(issue.GetBody())
+	if match == nil {
+		return nil, nil
+	}
+	return decodeJSON([]byte(match[1]))
+}
+
+func (s *IssueStore) Save(ctx context.Context, progress *Progress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	body := progressIssueHeader + "```json\n" + string(data) + "\n```\n"
+	if n := utf8.RuneCountInString(body); n > maxIssueBodySize {
+		return fmt.Errorf("the progress of %d characters does not fit in the body of issue #%d, at most %d, "+
+			"keep it on a branch or in a gist instead", n, s.number, maxIssueBodySize)
+	}
+	if err := s.client.EditIssue(ctx, s.number, &github.IssueRequest{Body: github.String(body)}); err != nil {
+		return fmt.Errorf("failed to update issue #%d, %v", s.number, err)
+	}
+	logrus.Infof("Commenter progress saved to issue #%d", s.number)
+	return nil
+}
+
+// SaveSummary comments the summary on the issue, issue bodies being too short to keep summaries in.
+func (s *IssueStore) SaveSummary(ctx context.Context, name string, data []byte) error {
+	body := fmt.Sprintf("`%s`\n\n```yaml\n%s```\n", name, data)
+	if err := s.client.PostPRComment(ctx, s.number, &body); err != nil {
+		return fmt.Errorf("failed to comment on issue #%d, %v", s.number, err)
+	}
+	logrus.Infof("Pull request summary saved to issue #%d", s.number)
+	return nil
+}
+
+// GistStore keeps the progress as a JSON file of a gist.
+type GistStore struct {
+	client *fgithub.RepositoryClient
+	id     string
+	file   string
+}
+
+func NewGistStore(client *fgithub.RepositoryClient, id, file string) *GistStore {
+	if file == "" {
+		file = "commenter-progress.json"
+	}
+	return &GistStore{client: client, id: id, file: file}
+}
+
+func (s *GistStore) Load(ctx context.Context) (*Progress, error) {
+	data, err := s.client.GetGistFile(ctx, s.id, s.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gist %s, %v", s.id, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return decodeJSON(data)
+}
+
+func (s *GistStore) Save(ctx context.Context, progress *Progress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := s.client.EditGistFile(ctx, s.id, s.file, data); err != nil {
+		return fmt.Errorf("failed to update gist %s, %v", s.id, err)
+	}
+	logrus.Infof("Commenter progress saved to gist %s", s.id)
+	return nil
+}
+
+// SaveSummary saves the summary as a file of the gist, gists having no directories.
+func (s *GistStore) SaveSummary(ctx context.Context, name string, data []byte) error {
+	if err := s.client.EditGistFile(ctx, s.id, summaryDir+"-"+name, data); err != nil {
+		return fmt.Errorf("failed to update gist %s, %v", s.id, err)
+	}
+	logrus.Infof("Pull request summary saved to gist %s", s.id)
+	return nil
+}
@@ -0,0 +1,136 @@
+package commenter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fgithub "github.com/operator-framework/flak-analyzer/pkg/github"
+	"github.com/operator-framework/flak-analyzer/pkg/github/fake"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commenter-store-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	store := NewFileStore(filepath.Join(dir, "progress", "commenter.yaml"))
+	progress, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, progress)
+
+	saved := &Progress{Version: ProgressVersion, Commented: []*Commenter{{Owner: owner, Repo: repo}}}
+	require.NoError(t, store.Save(ctx, saved))
+	progress, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, saved.Version, progress.Version)
+	require.Len(t, progress.Commented, 1)
+	assert.Equal(t, repo, progress.Commented[0].Repo)
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "progress"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files are left behind")
+}
+
+func TestIssueStoreTooLarge(t *testing.T) {
+	c := &Commenter{Owner: owner, Repo: repo, Runs: map[string]*RunRecord{}}
+	for i := 0; i < 1000; i++ {
+		c.Runs[strconv.Itoa(i)] = &RunRecord{PR: i, Commit: "1af968cb786e652f76cc0d9e5dd7d079bea984cb"}
+	}
+	err := NewIssueStore(nil, 7).Save(context.Background(),
+		&Progress{Version: ProgressVersion, Commented: []*Commenter{c}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not fit in the body of issue #7, at most 65536")
+}
+
+func TestBranchStoreSaveSummary(t *testing.T) {
+	s := fake.NewServer()
+	defer s.Close()
+	client, err := fgithub.NewRepositoryClient(context.Background(), "token", owner, commenterRepo, false,
+		fgithub.WithEnterpriseURLs(s.URL, ""))
+	require.NoError(t, err)
+
+	store := NewBranchStore(client, "flake-analyzer-progress", "commenter/progress.json")
+	name := owner + "-" + repo + "-1641.yaml"
+	require.NoError(t, store.SaveSummary(context.Background(), name, []byte("merged: false\n")))
+	require.NoError(t, store.SaveSummary(context.Background(), name, []byte("merged: true\n")))
+	assert.Equal(t, "merged: true\n",
+		string(s.File(owner, commenterRepo, "flake-analyzer-progress", "commenter/pr-summaries/"+name)))
+}
+
+func TestFileStoreVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commenter-store-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	path := filepath.Join(dir, "commenter.yaml")
+	store := NewFileStore(path)
+
+	// Progress written before the schema was versioned, with the run IDs of version 1.
+	require.NoError(t, ioutil.WriteFile(path, []byte("commented:\n- owner: "+owner+"\n  runids:\n    \"42\": {}\n"),
+		0644))
+	progress, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ProgressVersion, progress.Version)
+	require.Len(t, progress.Commented, 1)
+	assert.Nil(t, progress.Commented[0].RunIDs)
+	require.Contains(t, progress.Commented[0].Runs, "42")
+	assert.False(t, progress.Commented[0].Runs["42"].FirstSeen.IsZero())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("version: 3\n"), 0644))
+	_, err = store.Load(ctx)
+	assert.Error(t, err)
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commenter-store-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(filepath.Join(dir, "commenter.yaml"))
+	unlock, err := store.Lock(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = store.Lock(ctx)
+	assert.Error(t, err, "the lock is held")
+
+	require.NoError(t, unlock())
+	unlock, err = store.Lock(context.Background())
+	require.NoError(t, err)
+	assert.NoError(t, unlock())
+}
+
+func TestFileStoreLockRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commenter-store-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(interval time.Duration) { lockRefreshInterval = interval }(lockRefreshInterval)
+	lockRefreshInterval = 10 * time.Millisecond
+
+	store := NewFileStore(filepath.Join(dir, "commenter.yaml"))
+	unlock, err := store.Lock(context.Background())
+	require.NoError(t, err)
+	lock := filepath.Join(dir, "commenter.yaml.lock")
+	old := time.Now().Add(-2 * staleLockAge)
+	require.NoError(t, os.Chtimes(lock, old, old))
+
+	// A commenter holding the lock longer than staleLockAge keeps it.
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(lock)
+		return err == nil && time.Since(info.ModTime()) < staleLockAge
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, unlock())
+	_, err = os.Stat(lock)
+	assert.True(t, os.IsNotExist(err), "the lock is still held")
+}
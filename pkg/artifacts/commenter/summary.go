@@ -0,0 +1,241 @@
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/reporter"
+	fgithub "github.com/operator-framework/flak-analyzer/pkg/github"
+)
+
+// PRSummary is what flakes cost a pull request in a test suite, summarized once it is merged or closed.
+type PRSummary struct {
+	Owner     string
+	Repo      string
+	PR        int
+	TestSuite string
+	Merged    bool
+	Closed    time.Time
+	// Runs is the number of runs with test reports of the test suite, FailedRuns the number of those that failed.
+	Runs       int
+	FailedRuns int
+	// Reruns is the number of reruns of known flakes triggered by the commenter.
+	Reruns int
+	// FailedTests are the tests that failed on the pull request, most failed first.
+	FailedTests []SummaryTest
+	// WastedMinutes estimates the CI time spent on the failed runs, from their start to their last update.
+	WastedMinutes float64
+}
+
+// SummaryTest is a test that failed on a pull request.
+type SummaryTest struct {
+	Name     string
+	Failures int
+	// Classification is set if failures are classified against a baseline branch, see SetBaseline.
+	Classification reporter.Classification `yaml:",omitempty"`
+}
+
+// closedPR is a pull request found merged or closed, with its recorded runs and reruns.
+type closedPR struct {
+	number int
+	runs   map[string]RunRecord
+	reruns []Rerun
+}
+
+// SetPRSummaries summarizes what flakes cost pull requests once they are merged or closed: the summary is posted as
+// a comment if comment is true, and written to dir as <owner>-<repo>-<number>[-<test suite>].yaml if dir is not
+// empty. Summaries are also saved with the progress if its store is a SummaryStore.
+func (f *CommenterFile) SetPRSummaries(comment bool, dir string) {
+	f.summaryComment = comment
+	f.summaryDir = dir
+}
+
+func (f *CommenterFile) summaries() bool {
+	return f.summaryComment || f.summaryDir != ""
+}
+
+// closedPRs returns the pull requests with runs recorded as open that are not among the open pull requests.
+func (c *Commenter) closedPRs(open map[int]bool) []closedPR {
+	byNumber := map[int]*closedPR{}
+	for id, r := range c.Runs {
+		if r.PR == 0 || r.Closed != nil || open[r.PR] {
+			continue
+		}
+		closed, ok := byNumber[r.PR]
+		if !ok {
+			closed = &closedPR{number: r.PR, runs: map[string]RunRecord{},
+				reruns: c.Reruns[strconv.Itoa(r.PR)]}
+			byNumber[r.PR] = closed
+		}
+		closed.runs[id] = *r
+	}
+	var prs []closedPR
+	for _, closed := range byNumber {
+		prs = append(prs, *closed)
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].number < prs[j].number })
+	return prs
+}
+
+// summarizePullRequest summarizes what flakes cost a merged or closed pull request, see SetPRSummaries.
+func (f *CommenterFile) summarizePullRequest(ctx context.Context, c *Commenter, closed closedPR) error {
+	pr, _, err := c.client.PullRequests.Get(ctx, c.Owner, c.Repo, closed.number)
+	if err != nil {
+		return err
+	}
+	summary := &PRSummary{
+		Owner:     c.Owner,
+		Repo:      c.Repo,
+		PR:        closed.number,
+		TestSuite: c.TestNameMatcher,
+		Merged:    pr.GetMerged(),
+		Closed:    pr.GetClosedAt(),
+		Reruns:    len(closed.reruns),
+	}
+	if summary.Closed.IsZero() {
+		summary.Closed = time.Now()
+	}
+
+	prc := pullRequest{pr: closed.number, runCommits: map[string]string{}}
+	var ids []string
+	for id, r := range closed.runs {
+		ids = append(ids, id)
+		prc.runCommits[id] = r.Commit
+	}
+	sort.Strings(ids)
+	runs, err := c.workflowRuns(ctx, prc, ids)
+	if err != nil {
+		return err
+	}
+	summary.Runs = len(runs)
+	var wasted time.Duration
+	for _, run := range runs {
+		if run.GetConclusion() == "failure" {
+			summary.FailedRuns++
+			wasted += run.GetUpdatedAt().Sub(run.GetCreatedAt().Time)
+		}
+	}
+	summary.WastedMinutes = wasted.Minutes()
+
+	if summary.FailedRuns > 0 {
+		report, err := f.loadReport(c, closed.number, "")
+		if err != nil {
+			return err
+		}
+		if _, err := report.GenerateReport(""); err != nil {
+			return err
+		}
+		for _, test := range report.FlakeTests {
+			class, _ := report.ClassificationOf(test)
+			summary.FailedTests = append(summary.FailedTests, SummaryTest{Name: test.Name, Failures: test.Counts,
+				Classification: class})
+		}
+		sort.Slice(summary.FailedTests, func(i, j int) bool {
+			a, b := summary.FailedTests[i], summary.FailedTests[j]
+			return a.Failures > b.Failures || (a.Failures == b.Failures && a.Name < b.Name)
+		})
+	}
+
+	if err := f.saveSummary(ctx, summary); err != nil {
+		return err
+	}
+	if f.summaryComment {
+		body := summary.comment()
+		if err := c.client.PostPRComment(ctx, closed.number, &body); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("Summarized %d runs of %s pull request %s/%s#%d", summary.Runs, summary.state(), c.Owner, c.Repo,
+		closed.number)
+	return nil
+}
+
+func (s *PRSummary) state() string {
+	if s.Merged {
+		return "merged"
+	}
+	return "closed"
+}
+
+// comment renders the summary as a pull request comment.
+func (s *PRSummary) comment() string {
+	var b strings.Builder
+	b.WriteString("### Flake summary")
+	if s.TestSuite != "" {
+		fmt.Fprintf(&b, " of %s", s.TestSuite)
+	}
+	fmt.Fprintf(&b, "\n\nThis pull request was %s after %s, %d of which failed", s.state(),
+		reporter.Plural(s.Runs, "run", "runs"), s.FailedRuns)
+	if s.FailedRuns > 0 {
+		fmt.Fprintf(&b, ", spending an estimated %.0f minutes of CI on failed runs", s.WastedMinutes)
+	}
+	b.WriteString(".")
+	if s.Reruns > 0 {
+		fmt.Fprintf(&b, " %s of known flakes were triggered.", reporter.Plural(s.Reruns, "rerun", "reruns"))
+	}
+	b.WriteString("\n")
+	if len(s.FailedTests) > 0 {
+		b.WriteString("\n| Test | Failures |")
+		classified := s.FailedTests[0].Classification != ""
+		if classified {
+			b.WriteString(" Classification |")
+		}
+		b.WriteString("\n|------|----------|")
+		if classified {
+			b.WriteString("----------------|")
+		}
+		b.WriteString("\n")
+		for _, t := range s.FailedTests {
+			fmt.Fprintf(&b, "| %s | %d |", strings.ReplaceAll(t.Name, "|", "\\|"), t.Failures)
+			if classified {
+				fmt.Fprintf(&b, " %s |", t.Classification)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// fileName names the summary after its pull request and test suite.
+func (s *PRSummary) fileName() string {
+	name := fmt.Sprintf("%s-%s-%d", s.Owner, s.Repo, s.PR)
+	if s.TestSuite != "" {
+		name += "-" + s.TestSuite
+	}
+	return fgithub.SafeFileName(name) + ".yaml"
+}
+
+// saveSummary writes the summary as YAML to the summary directory, and saves it with the progress. Dry runs leave the
+// progress store untouched.
+func (f *CommenterFile) saveSummary(ctx context.Context, s *PRSummary) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if f.summaryDir != "" {
+		if err := os.MkdirAll(f.summaryDir, 0755); err != nil {
+			return err
+		}
+		path := filepath.Join(f.summaryDir, s.fileName())
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write the summary of pull request #%d, %v", s.PR, err)
+		}
+		logrus.Infof("Pull request summary written to %s", path)
+	}
+	if store, ok := f.store.(SummaryStore); ok && !fgithub.IsDryRun(f.options...) {
+		if err := store.SaveSummary(ctx, s.fileName(), data); err != nil {
+			return fmt.Errorf("failed to save the summary of pull request #%d, %v", s.PR, err)
+		}
+	}
+	return nil
+}
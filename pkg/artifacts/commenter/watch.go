@@ -0,0 +1,101 @@
+package commenter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// unhealthyPolls is the number of poll intervals without a successful poll after which a watching commenter reports
+// itself unhealthy.
+const unhealthyPolls = 3
+
+// Health is the state of a watching commenter, served as JSON by its health endpoint.
+type Health struct {
+	Started     time.Time  `json:"started"`
+	Interval    string     `json:"interval"`
+	Polls       int        `json:"polls"`
+	LastPoll    *time.Time `json:"last_poll,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Healthy     bool       `json:"healthy"`
+}
+
+type watchState struct {
+	mu       sync.Mutex
+	interval time.Duration
+	health   Health
+}
+
+// Watch generates comments every interval until ctx is done. The progress is kept in memory between polls, which
+// only list new artifacts and the commits of updated pull requests, and saved to the progress store after each
+// successful poll. A failed poll is logged and its runs are reported on by the next one. A poll in progress when ctx
+// is done is completed before Watch returns.
+func (f *CommenterFile) Watch(ctx context.Context, interval time.Duration) error {
+	f.watch.mu.Lock()
+	f.watch.interval = interval
+	f.watch.health = Health{Started: time.Now(), Interval: interval.String()}
+	f.watch.mu.Unlock()
+
+	for {
+		start := time.Now()
+		comments, err := f.GenerateComments()
+
+		f.watch.mu.Lock()
+		f.watch.health.Polls++
+		f.watch.health.LastPoll = &start
+		if err != nil {
+			f.watch.health.LastError = err.Error()
+		} else {
+			f.watch.health.LastSuccess = &start
+			f.watch.health.LastError = ""
+		}
+		f.watch.mu.Unlock()
+
+		if err != nil {
+			logrus.Errorf("Failed to generate comments, retrying in %s: %v", interval, err)
+		} else {
+			logrus.Infof("Posted %d comments in %s, polling again in %s", len(comments),
+				time.Since(start).Round(time.Millisecond), interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			logrus.Infof("Stopped watching, %v", ctx.Err())
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Health returns the state of a watching commenter. It is healthy while the last successful poll, or the start if
+// there was none yet, is at most three intervals old.
+func (f *CommenterFile) Health() Health {
+	f.watch.mu.Lock()
+	defer f.watch.mu.Unlock()
+	health := f.watch.health
+	since := health.Started
+	if health.LastSuccess != nil {
+		since = *health.LastSuccess
+	}
+	health.Healthy = !health.Started.IsZero() && time.Since(since) <= unhealthyPolls*f.watch.interval
+	return health
+}
+
+// HealthHandler serves the Health of a watching commenter, with status 503 Service Unavailable when it is unhealthy.
+func (f *CommenterFile) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := f.Health()
+		status := http.StatusOK
+		if !health.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(health)
+	})
+}
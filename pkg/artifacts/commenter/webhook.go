@@ -0,0 +1,444 @@
+package commenter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPayloadSize is the size limit of webhook payloads documented by GitHub.
+	maxPayloadSize = 25 << 20
+	// maxDeliveries is the number of delivery IDs remembered to ignore redelivered events.
+	maxDeliveries = 10000
+)
+
+// workflowRunEvent is the payload of workflow_run events, which go-github does not provide.
+type workflowRunEvent struct {
+	Action      string              `json:"action"`
+	WorkflowRun *github.WorkflowRun `json:"workflow_run"`
+	Repository  *github.Repository  `json:"repository"`
+}
+
+type prKey struct {
+	owner, repo string
+	number      int
+}
+
+// WebhookHandler reports on pull requests as GitHub webhook events arrive: when a workflow run on a pull request
+// completes, when new commits are pushed to a pull request and, if enabled, when slash commands are posted. Reports
+// are made in the background, at most concurrency at a time and one at a time per pull request. Reports held back by
+// QuietPolicy.MinInterval are made again once it has passed. Pushes to the default branch of a repository reload its
+// configuration file.
+type WebhookHandler struct {
+	f      *CommenterFile
+	secret []byte
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	deliveries map[string]struct{}
+	order      []string
+	// pending holds the pull requests being reported on, true for those with events received since the report began.
+	pending map[prKey]bool
+	// retries holds the timers reporting again on pull requests held back by QuietPolicy.MinInterval.
+	retries map[prKey]*time.Timer
+	stopped bool
+}
+
+// WebhookHandler returns a handler for webhooks signed with secret, reporting on at most concurrency pull requests at
+// a time.
+func (f *CommenterFile) WebhookHandler(secret []byte, concurrency int) *WebhookHandler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &WebhookHandler{
+		f:          f,
+		secret:     secret,
+		slots:      make(chan struct{}, concurrency),
+		deliveries: map[string]struct{}{},
+		pending:    map[prKey]bool{},
+		retries:    map[prKey]*time.Timer{},
+	}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(payload) > maxPayloadSize {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := github.ValidateSignature(r.Header.Get("X-Hub-Signature-256"), payload, h.secret); err != nil {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if !h.firstDelivery(r.Header.Get("X-GitHub-Delivery")) {
+		fmt.Fprintln(w, "duplicate delivery")
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	switch event {
+	case "workflow_run":
+		e := &workflowRunEvent{}
+		if err := json.Unmarshal(payload, e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.Action != "completed" || e.WorkflowRun == nil {
+			break
+		}
+		owner, repo := e.Repository.GetOwner().GetLogin(), e.Repository.GetName()
+		if len(e.WorkflowRun.PullRequests) == 0 {
+			// Runs on pull requests from forks do not list them, look them up by head commit.
+			h.lookUp(owner, repo, e.WorkflowRun.GetHeadSHA())
+		}
+		for _, pr := range e.WorkflowRun.PullRequests {
+			h.enqueue(owner, repo, pr.GetNumber())
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case "pull_request":
+		e := &github.PullRequestEvent{}
+		if err := json.Unmarshal(payload, e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Closed and reopened pull requests update the retention of their runs, drafts ready for review and removed
+		// opt-out labels release held back reports.
+		if a := e.GetAction(); a != "synchronize" && a != "closed" && a != "reopened" && a != "ready_for_review" &&
+			a != "unlabeled" {
+			break
+		}
+		h.enqueue(e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName(), e.GetNumber())
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case "issue_comment":
+		e := &github.IssueCommentEvent{}
+		if err := json.Unmarshal(payload, e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !h.f.commands || e.GetAction() != "created" || e.GetIssue() == nil || !e.GetIssue().IsPullRequest() ||
+			len(parseCommands(e.GetComment().GetBody())) == 0 {
+			break
+		}
+		h.enqueue(e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName(), e.GetIssue().GetNumber())
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case "push":
+		e := &github.PushEvent{}
+		if err := json.Unmarshal(payload, e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.GetRef() != "refs/heads/"+e.GetRepo().GetDefaultBranch() {
+			break
+		}
+		h.reloadConfig(e.GetRepo().GetOwner().GetLogin(), e.GetRepo().GetName())
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	fmt.Fprintf(w, "ignored %s event\n", event)
+}
+
+// Wait cancels the reports held back until later and waits for the reports in progress to complete.
+func (h *WebhookHandler) Wait() {
+	h.mu.Lock()
+	h.stopped = true
+	for key, t := range h.retries {
+		if t.Stop() {
+			h.wg.Done()
+		}
+		delete(h.retries, key)
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+}
+
+// firstDelivery records a delivery and returns whether it was not received before. Events without a delivery ID are
+// never considered redelivered.
+func (h *WebhookHandler) firstDelivery(id string) bool {
+	if id == "" {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.deliveries[id]; ok {
+		return false
+	}
+	h.deliveries[id] = struct{}{}
+	h.order = append(h.order, id)
+	if len(h.order) > maxDeliveries {
+		delete(h.deliveries, h.order[0])
+		h.order = h.order[1:]
+	}
+	return true
+}
+
+// enqueue reports on a pull request in the background. If a report on it is in progress, another one follows once it
+// completes, however many events arrive meanwhile.
+func (h *WebhookHandler) enqueue(owner, repo string, number int) {
+	key := prKey{owner: strings.ToLower(owner), repo: strings.ToLower(repo), number: number}
+	h.mu.Lock()
+	if _, ok := h.pending[key]; ok {
+		h.pending[key] = true
+		h.mu.Unlock()
+		return
+	}
+	h.pending[key] = false
+	h.mu.Unlock()
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		for {
+			h.slots <- struct{}{}
+			_, wait, err := h.f.reportPullRequestEvent(context.Background(), owner, repo, number)
+			if err != nil {
+				logrus.Errorf("Failed to report on pull request %s/%s#%d, %v", owner, repo, number, err)
+			}
+			<-h.slots
+			if wait > 0 {
+				h.retry(key, owner, repo, number, wait)
+			}
+
+			h.mu.Lock()
+			again := h.pending[key]
+			if again {
+				h.pending[key] = false
+			} else {
+				delete(h.pending, key)
+			}
+			h.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// retry reports on a pull request again after wait, unless it already will be or the handler is stopped.
+func (h *WebhookHandler) retry(key prKey, owner, repo string, number int, wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.retries[key]; ok || h.stopped {
+		return
+	}
+	h.wg.Add(1)
+	h.retries[key] = time.AfterFunc(wait, func() {
+		defer h.wg.Done()
+		h.mu.Lock()
+		delete(h.retries, key)
+		h.mu.Unlock()
+		h.enqueue(owner, repo, number)
+	})
+}
+
+// lookUp reports on the open pull requests with the head commit sha in the background.
+func (h *WebhookHandler) lookUp(owner, repo, sha string) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.slots <- struct{}{}
+		numbers, err := h.f.pullRequestsWithHead(context.Background(), owner, repo, sha)
+		<-h.slots
+		if err != nil {
+			logrus.Errorf("Failed to look up the pull requests of %s/%s with head %s, %v", owner, repo, sha, err)
+			return
+		}
+		for _, n := range numbers {
+			h.enqueue(owner, repo, n)
+		}
+	}()
+}
+
+// reloadConfig reads the configuration file of a repository again in the background.
+func (h *WebhookHandler) reloadConfig(owner, repo string) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.slots <- struct{}{}
+		defer func() { <-h.slots }()
+		if err := h.f.reloadRepoConfig(context.Background(), owner, repo); err != nil {
+			logrus.Errorf("Failed to reload the configuration of %s/%s, %v", owner, repo, err)
+		}
+	}()
+}
+
+// commenters returns the commenters of a repository, one per test suite.
+func (f *CommenterFile) commenters(owner, repo string) []*Commenter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var commenters []*Commenter
+	for _, c := range f.Commented {
+		if strings.EqualFold(c.Owner, owner) && strings.EqualFold(c.Repo, repo) && c.active {
+			commenters = append(commenters, c)
+		}
+	}
+	return commenters
+}
+
+// pullRequestsWithHead returns the numbers of the open pull requests of a repository with the head commit sha.
+func (f *CommenterFile) pullRequestsWithHead(ctx context.Context, owner, repo, sha string) ([]int, error) {
+	commenters := f.commenters(owner, repo)
+	if len(commenters) == 0 {
+		return nil, nil
+	}
+	prs, err := commenters[0].listPRs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, pr := range prs {
+		if pr.GetHead().GetSHA() == sha {
+			numbers = append(numbers, pr.GetNumber())
+		}
+	}
+	return numbers, nil
+}
+
+// ReportPullRequest reports the runs of a pull request not reported on yet, for each test suite of the repository
+// added with AddRepo, runs the slash commands posted since the last report if enabled, and saves the progress. It
+// returns the report comments posted.
+func (f *CommenterFile) ReportPullRequest(ctx context.Context, owner, repo string, number int) ([]*string, error) {
+	comments, _, err := f.reportPullRequestEvent(ctx, owner, repo, number)
+	return comments, err
+}
+
+// reportPullRequestEvent is ReportPullRequest, also returning how long until a report held back by
+// QuietPolicy.MinInterval may be made, zero if none was.
+func (f *CommenterFile) reportPullRequestEvent(ctx context.Context, owner, repo string, number int) ([]*string,
+	time.Duration, error) {
+	var comments []*string
+	var retry time.Duration
+	var suites []suitePR
+	for _, c := range f.commenters(owner, repo) {
+		pr, _, err := c.client.PullRequests.Get(ctx, c.Owner, c.Repo, number)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pr.GetState() != "open" {
+			if f.summaries() {
+				f.mu.Lock()
+				var closed []closedPR
+				for _, p := range c.closedPRs(nil) {
+					if p.number == number {
+						closed = append(closed, p)
+					}
+				}
+				f.mu.Unlock()
+				for _, pr := range closed {
+					if err := f.summarizePullRequest(ctx, c, pr); err != nil {
+						return nil, 0, err
+					}
+				}
+			}
+			f.mu.Lock()
+			c.closeRuns(number, time.Now())
+			c.pruneRuns(time.Now(), f.retention)
+			f.mu.Unlock()
+			if err := f.saveProgress(ctx); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		commits, err := c.client.ListCommitsFromPR(ctx, number)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		artifacts, err := c.listArtifacts(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		commitRunIDs, runArtifacts, err := c.commitRunIDs(artifacts)
+		if err != nil {
+			return nil, 0, err
+		}
+		var runIDs []string
+		runCommits := map[string]string{}
+		for _, commit := range commits {
+			runIDs = append(runIDs, commitRunIDs[commit]...)
+			for _, id := range commitRunIDs[commit] {
+				runCommits[id] = commit
+			}
+		}
+		f.mu.Lock()
+		newRunIDs := c.newRunIDs(runIDs, runArtifacts)
+		f.mu.Unlock()
+		prc := pullRequest{
+			pr:           number,
+			head:         pr.GetHead().GetSHA(),
+			draft:        pr.GetDraft(),
+			labels:       labelNames(pr.Labels),
+			commits:      commits,
+			runIDs:       runIDs,
+			newRunIDs:    newRunIDs,
+			runCommits:   runCommits,
+			runArtifacts: runArtifacts,
+		}
+		f.mu.Lock()
+		reopened := c.openRuns(prc)
+		f.mu.Unlock()
+		suites = append(suites, suitePR{c: c, prc: prc})
+		if len(newRunIDs) == 0 && !reopened {
+			continue
+		}
+
+		if len(newRunIDs) > 0 {
+			reason, err := f.holdBack(ctx, c, prc)
+			if err != nil {
+				return nil, 0, err
+			}
+			if reason != "" {
+				logrus.Infof("Holding back the report on pull request %s/%s#%d, %s", owner, repo, number, reason)
+				newRunIDs = nil
+				if wait := f.commentWait(c, number); wait > retry {
+					retry = wait
+				}
+			}
+		}
+		if len(newRunIDs) > 0 {
+			comment, err := f.reportPullRequest(ctx, c, prc)
+			if err != nil {
+				return nil, 0, err
+			}
+			if comment != nil {
+				comments = append(comments, comment)
+			}
+			logrus.Infof("Reported %d runs of pull request %s/%s#%d", len(newRunIDs), owner, repo, number)
+		}
+
+		if err := f.saveProgress(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+	// Slash commands are run once for all test suites.
+	if f.commands && len(suites) > 0 {
+		if err := f.handleCommands(ctx, suites); err != nil {
+			return nil, 0, err
+		}
+		if err := f.saveProgress(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+	return comments, retry, nil
+}
@@ -0,0 +1,90 @@
+package commenter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	secret := []byte("webhook-secret")
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	h := (&CommenterFile{}).WebhookHandler(secret, 2)
+
+	tests := []struct {
+		name      string
+		event     string
+		delivery  string
+		signature string
+		status    int
+		body      string
+	}{
+		{name: "Missing signature", event: "ping", delivery: "1", status: http.StatusUnauthorized},
+		{name: "Invalid signature", event: "ping", delivery: "1", signature: sign("{}x"),
+			status: http.StatusUnauthorized},
+		{name: "Valid signature", event: "ping", delivery: "1", signature: sign("{}"), status: http.StatusOK,
+			body: "ignored ping event"},
+		{name: "Redelivery", event: "ping", delivery: "1", signature: sign("{}"), status: http.StatusOK,
+			body: "duplicate delivery"},
+		{name: "Other delivery", event: "ping", delivery: "2", signature: sign("{}"), status: http.StatusOK,
+			body: "ignored ping event"},
+		{name: "Incomplete workflow run", event: "workflow_run", delivery: "3", signature: sign("{}"),
+			status: http.StatusOK, body: "ignored workflow_run event"},
+		{name: "Push to another branch", event: "push", delivery: "4", signature: sign("{}"),
+			status: http.StatusOK, body: "ignored push event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{}"))
+			r.Header.Set("X-GitHub-Event", tt.event)
+			r.Header.Set("X-GitHub-Delivery", tt.delivery)
+			if tt.signature != "" {
+				r.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestWebhookHandlerRetry(t *testing.T) {
+	h := (&CommenterFile{}).WebhookHandler(nil, 1)
+	key := prKey{owner: owner, repo: repo, number: 1}
+
+	// Held back pull requests are reported on again once the wait is over, once however often they are held back.
+	h.retry(key, owner, repo, 1, 10*time.Millisecond)
+	h.retry(key, owner, repo, 1, time.Hour)
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.retries) == 0 && len(h.pending) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Waiting cancels the reports held back, and none are held back afterwards.
+	h.retry(key, owner, repo, 1, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		h.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not cancel the held back report")
+	}
+	h.retry(key, owner, repo, 1, time.Millisecond)
+	assert.Empty(t, h.retries)
+}
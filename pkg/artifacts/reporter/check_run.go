@@ -0,0 +1,171 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gh "github.com/google/go-github/v32/github"
+
+	"github.com/operator-framework/flak-analyzer/pkg/github"
+)
+
+const (
+	// maxCheckRunText is the length limit of the summary and of annotation messages of a check run.
+	maxCheckRunText = 65535
+	// maxAnnotationTitle is the length limit of annotation titles.
+	maxAnnotationTitle = 255
+)
+
+// goLocation matches Go source locations, e.g. /home/runner/work/repo/repo/test/e2e/bundle_e2e_test.go:78.
+var goLocation = regexp.MustCompile(`([\w./-]+\.go):(\d+)`)
+
+// workspacePrefix matches the checkout directory of GitHub Actions runners, <runner>/_work/<repo>/<repo>/ on
+// self-hosted runners and /home/runner/work/<repo>/<repo>/ on hosted ones.
+var workspacePrefix = regexp.MustCompile(`^/.*?/_?work/[^/]+/[^/]+/`)
+
+// CheckRunName returns the name of the check run published for a test suite.
+func CheckRunName(testsuite string) string {
+	if testsuite == "" {
+		return "Flake Analyzer"
+	}
+	return fmt.Sprintf("Flake Analyzer (%s)", testsuite)
+}
+
+// PublishCheckRun publishes the report as a check run on the head commit of the pull request, or on the commit given
+// by WithHeadSHA. Its summary lists the failed tests and every failure becomes an annotation at the first location of
+// the failure body that lies in the repository.
+func (f *FlakeReport) PublishCheckRun(option ...filterOption) (*gh.CheckRun, error) {
+	f.filter.apply(option)
+	if len(f.FlakeTests) == 0 && len(f.SkippedTests) == 0 {
+		if _, err := f.GenerateReport(""); err != nil {
+			return nil, err
+		}
+	}
+
+	if (f.filter.token == "" && !github.HasCredentials(f.filter.clientOptions...)) || f.filter.owner == "" ||
+		f.filter.repo == "" {
+		return nil, fmt.Errorf("publishing check runs requires GitHub access token, repository owner and name information")
+	}
+
+	ctx := context.Background()
+	client, err := github.NewRepositoryClient(ctx, f.filter.token, f.filter.owner, f.filter.repo, false,
+		f.filter.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	headSHA := f.filter.headSHA
+	if headSHA == "" && f.filter.pullRequest != "" {
+		pr, err := strconv.Atoi(f.filter.pullRequest)
+		if err != nil {
+			return nil, err
+		}
+		if headSHA, err = client.GetPRHeadSHA(ctx, pr); err != nil {
+			return nil, err
+		}
+	}
+	if headSHA == "" {
+		return nil, fmt.Errorf("publishing check runs requires a pull request or head commit")
+	}
+
+	conclusion, title := "success", "No failed tests"
+	if len(f.FlakeTests) > 0 {
+		conclusion, title = "neutral", fmt.Sprintf("%d failed tests", len(f.FlakeTests))
+	}
+	return client.CreateCheckRun(ctx, headSHA, CheckRunName(f.filter.testsuite), conclusion, title,
+		f.checkRunSummary(), f.checkRunAnnotations())
+}
+
+func (f *FlakeReport) checkRunSummary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Failed **%d out of %d times** with %d individual failed tests and %d skipped tests. A test is"+
+		" considered flaky if failed on multiple commits.\n\n", f.FailedTestCount, f.TotalTestCount, f.FlakeTestCount,
+		f.SkippedTestCount)
+	if len(f.FlakeTests) == 0 {
+		return b.String()
+	}
+
+	b.WriteString("| Test | Failures | Commits | Mean duration |\n|------|----------|---------|---------------|\n")
+	for i, test := range f.FlakeTests {
+		row := fmt.Sprintf("| %s **%s** | %d | %d | %.1fs |\n", escapeTableCell(test.ClassName),
+			escapeTableCell(test.Name), test.Counts, len(test.Commits), test.MeanDurationSec)
+		omitted := fmt.Sprintf("\n%d more failed tests are not listed.\n", len(f.FlakeTests)-i)
+		if b.Len()+len(row)+len(omitted) > maxCheckRunText {
+			b.WriteString(omitted)
+			break
+		}
+		b.WriteString(row)
+	}
+	return b.String()
+}
+
+func (f *FlakeReport) checkRunAnnotations() []*gh.CheckRunAnnotation {
+	var annotations []*gh.CheckRunAnnotation
+	for _, test := range f.FlakeTests {
+		for _, detail := range test.Details {
+			if detail.Error == nil {
+				continue
+			}
+			path, line, ok := failureLocation(detail.Error.Error())
+			if !ok {
+				continue
+			}
+			annotations = append(annotations, &gh.CheckRunAnnotation{
+				Path:            gh.String(path),
+				StartLine:       gh.Int(line),
+				EndLine:         gh.Int(line),
+				AnnotationLevel: gh.String("failure"),
+				Title:           gh.String(truncate(strings.TrimSpace(test.ClassName+" "+test.Name), maxAnnotationTitle)),
+				Message: gh.String(truncate(fmt.Sprintf("Failed %d times:\n%s", detail.Count,
+					strings.TrimSpace(detail.Error.Error())), maxCheckRunText)),
+			})
+		}
+	}
+	return annotations
+}
+
+// failureLocation returns the repository relative path and line of the first location in a failure body that lies
+// in the repository. Absolute paths outside of the runner workspace, bare file names and vendored files are skipped.
+func failureLocation(body string) (string, int, bool) {
+	path, line, _, ok := failureLocationIndex(body)
+	return path, line, ok
+}
+
+// failureLocationIndex is failureLocation that also returns the offset of the location in body.
+func failureLocationIndex(body string) (string, int, int, bool) {
+	for _, match := range goLocation.FindAllStringSubmatchIndex(body, -1) {
+		path := body[match[2]:match[3]]
+		if strings.HasPrefix(path, "/") {
+			prefix := workspacePrefix.FindString(path)
+			if prefix == "" {
+				continue
+			}
+			path = strings.TrimPrefix(path, prefix)
+		} else if !strings.Contains(path, "/") {
+			continue
+		}
+		if strings.HasPrefix(path, "vendor/") || strings.Contains(path, "/vendor/") {
+			continue
+		}
+		line, err := strconv.Atoi(body[match[4]:match[5]])
+		if err != nil || line == 0 {
+			continue
+		}
+		return path, line, match[0], true
+	}
+	return "", 0, 0, false
+}
+
+func escapeTableCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n-3], "") + "..."
+}
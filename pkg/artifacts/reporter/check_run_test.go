@@ -0,0 +1,38 @@
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		line int
+	}{
+		{name: "hosted runner workspace",
+			body: "\n\n/home/runner/work/operator-lifecycle-manager/operator-lifecycle-manager/test/e2e/bundle_e2e_test.go:78\n" +
+				"Timed out after 60.000s.\n/home/runner/work/operator-lifecycle-manager/operator-lifecycle-manager/test/e2e/bundle_e2e_test.go:98",
+			path: "test/e2e/bundle_e2e_test.go", line: 78},
+		{name: "self-hosted runner workspace",
+			body: "/opt/actions-runner/_work/olm/olm/pkg/controller/operators/catalog/operator_test.go:1203 +0x4f",
+			path: "pkg/controller/operators/catalog/operator_test.go", line: 1203},
+		{name: "skips bare file names and vendored files",
+			body: "\tError Trace:\tsubscription_e2e_test.go:78\n" +
+				"/home/runner/work/olm/olm/vendor/github.com/stretchr/testify/require/require.go:1005\n" +
+				"\t\t\ttest/e2e/util_test.go:42",
+			path: "test/e2e/util_test.go", line: 42},
+		{name: "outside of the workspace", body: "/usr/local/go/src/testing/testing.go:991"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, line, ok := failureLocation(tt.body)
+			assert.Equal(t, tt.path != "", ok)
+			assert.Equal(t, tt.path, path)
+			assert.Equal(t, tt.line, line)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package reporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Classification tells pull request authors whether a failed test is likely to pass on a retest or needs a fix.
+type Classification string
+
+const (
+	// KnownFlake failed with the same error on the baseline branch.
+	KnownFlake Classification = "known flake"
+	// KnownTestNewError failed on the baseline branch, but with other errors.
+	KnownTestNewError Classification = "known test, new error"
+	// NewFailure did not fail on the baseline branch.
+	NewFailure Classification = "new failure"
+)
+
+type classification struct {
+	class Classification
+	// failures is the number of failures of the test on the baseline branch.
+	failures int
+}
+
+// baseline describes the history failed tests are classified against, e.g. "master in the last 7 days".
+type baseline struct {
+	branch          string
+	days            int
+	classifications map[string]classification
+	// history holds the failed tests on the branch.
+	history testMap
+}
+
+// fingerprintNoise matches the parts of failure messages that differ between otherwise identical failures: pointers,
+// numbers such as durations and line numbers, and the runner workspace.
+var fingerprintNoise = regexp.MustCompile(`0x[0-9a-fA-F]+|\d+(\.\d+)?|/\S*?/_?work/[^/\s]+/[^/\s]+/`)
+
+// fingerprint identifies a failure by its error message, ignoring details that change from run to run.
+func fingerprint(err error) string {
+	if err == nil {
+		return ""
+	}
+	normalized := strings.Join(strings.Fields(fingerprintNoise.ReplaceAllString(err.Error(), "#")), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Baseline holds the failures of a test suite on a branch over the last days, to classify any number of pull
+// request reports against without loading them again, see ClassifyAgainst.
+type Baseline struct {
+	branch  string
+	days    int
+	history testMap
+}
+
+// LoadBaseline loads the failures of the test suite of the repository given by options on branch over the last days.
+func LoadBaseline(branch string, days int, options ...filterOption) (*Baseline, error) {
+	history := NewFlakeReport()
+	options = append(options, FilterFromDaysAgo(days), FilterBranch(branch))
+	if err := history.LoadReport(options...); err != nil {
+		return nil, fmt.Errorf("failed to load the failures on %s, %v", branch, err)
+	}
+	return &Baseline{branch: branch, days: days, history: history.flakeTestMap}, nil
+}
+
+// CompareWithBranch loads the failures of the test suite on branch over the last days and classifies every failed
+// test of the report against them. The classification is shown in the pull request comment.
+func (f *FlakeReport) CompareWithBranch(branch string, days int) error {
+	b, err := LoadBaseline(branch, days, RepositoryInfo(f.filter.owner, f.filter.repo), WithToken(f.filter.token),
+		FilterTestSuite(f.filter.testsuite), WithTempDownloadDir(f.filter.tmpDir),
+		WaitWaitForQuotaReset(f.filter.waitForQuotaReset), WithClientOptions(f.filter.clientOptions...))
+	if err != nil {
+		return err
+	}
+	f.ClassifyAgainst(b)
+	return nil
+}
+
+// ClassifyAgainst classifies every failed test of the report against the failures of a baseline, see
+// CompareWithBranch.
+func (f *FlakeReport) ClassifyAgainst(b *Baseline) {
+	f.baseline = &baseline{
+		branch:          b.branch,
+		days:            b.days,
+		classifications: map[string]classification{},
+		history:         b.history,
+	}
+	for key, test := range f.flakeTestMap {
+		known, ok := b.history[key]
+		if !ok {
+			f.baseline.classifications[key] = classification{class: NewFailure}
+			continue
+		}
+
+		fingerprints := map[string]bool{}
+		for _, d := range known.Details {
+			fingerprints[fingerprint(d.Error)] = true
+		}
+		class := KnownTestNewError
+		for _, d := range test.Details {
+			if fingerprints[fingerprint(d.Error)] {
+				class = KnownFlake
+				break
+			}
+		}
+		// Tests failing without details can only be matched by name.
+		if len(test.Details) == 0 {
+			class = KnownFlake
+		}
+		f.baseline.classifications[key] = classification{class: class, failures: known.Counts}
+	}
+}
+
+// FailuresOn returns the names of the tests that failed on commit by classification. It returns nil if the report
+// was not compared with a branch.
+func (f *FlakeReport) FailuresOn(commit string) map[Classification][]string {
+	if f.baseline == nil {
+		return nil
+	}
+	failures := map[Classification][]string{}
+	for key, test := range f.flakeTestMap {
+		for _, c := range test.Commits {
+			if c == commit {
+				class := f.baseline.classifications[key].class
+				failures[class] = append(failures[class], test.Name)
+				break
+			}
+		}
+	}
+	for _, tests := range failures {
+		sort.Strings(tests)
+	}
+	return failures
+}
+
+// ClassificationOf returns the classification of a failed test of the report, and false if the report was not
+// compared with a branch.
+func (f *FlakeReport) ClassificationOf(test TestEntry) (Classification, bool) {
+	if f.baseline == nil {
+		return "", false
+	}
+	c, ok := f.baseline.classifications[test.ClassName+"/"+test.Name]
+	return c.class, ok
+}
+
+// KnownFlakesOn returns the names of the tests that failed on commit, and whether all of them are known flakes of the
+// baseline branch. It returns false if the report was not compared with a branch or no test failed on commit.
+func (f *FlakeReport) KnownFlakesOn(commit string) ([]string, bool) {
+	failures := f.FailuresOn(commit)
+	tests := failures[KnownFlake]
+	return tests, len(tests) > 0 && len(failures) == 1
+}
+
+// label returns the classification of a failed test as shown in comments, or an empty string if the report was not
+// compared with a branch.
+func (b *baseline) label(test TestEntry) string {
+	if b == nil {
+		return ""
+	}
+	c, ok := b.classifications[test.ClassName+"/"+test.Name]
+	if !ok {
+		return ""
+	}
+	switch c.class {
+	case KnownFlake:
+		return fmt.Sprintf("%s (failed %d× on %s in the last %d days)", c.class, c.failures, b.branch, b.days)
+	case KnownTestNewError:
+		return fmt.Sprintf("%s (failed %d× on %s in the last %d days with other errors)", c.class, c.failures,
+			b.branch, b.days)
+	default:
+		return fmt.Sprintf("%s, not seen on %s in the last %d days", c.class, b.branch, b.days)
+	}
+}
+
+// summary counts the failed tests per classification, e.g. "Compared with master in the last 7 days: 2 known flakes,
+// 0 known tests with new errors and 1 new failure."
+func (b *baseline) summary() string {
+	if b == nil {
+		return ""
+	}
+	counts := map[Classification]int{}
+	for _, c := range b.classifications {
+		counts[c.class]++
+	}
+	return fmt.Sprintf("Compared with %s in the last %d days: %s, %s and %s. Known flakes are likely to pass on a"+
+		" retest, new failures likely need a fix.", b.branch, b.days,
+		Plural(counts[KnownFlake], "known flake", "known flakes"),
+		Plural(counts[KnownTestNewError], "known test with a new error", "known tests with new errors"),
+		Plural(counts[NewFailure], "new failure", "new failures"))
+}
+
+// Plural returns n followed by the singular or plural noun, e.g. "1 run" or "2 runs".
+func Plural(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
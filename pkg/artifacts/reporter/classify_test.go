@@ -0,0 +1,52 @@
+package reporter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	history := NewFlakeReport()
+	history.flakeTestMap = testMap{
+		"e2e/flake": {ClassName: "e2e", Name: "flake", Counts: 12, Details: []TestDetail{{Count: 12,
+			Error: errors.New("/home/runner/work/olm/olm/test/e2e/gc_e2e_test.go:481\nTimed out after 60.000s." +
+				" <*errors.StatusError | 0xc00177d680>")}}},
+		"e2e/changed": {ClassName: "e2e", Name: "changed", Counts: 3, Details: []TestDetail{{Count: 3,
+			Error: errors.New("configmaps \"mock-ocs\" already exists")}}},
+	}
+
+	report := NewFlakeReport()
+	report.flakeTestMap = testMap{
+		"e2e/flake": {ClassName: "e2e", Name: "flake", Counts: 1, Commits: []string{"a"},
+			Details: []TestDetail{{Count: 1, Error: errors.New("/opt/runner/_work/olm/olm/test/e2e/gc_e2e_test.go:482" +
+				"\nTimed out after 30.000s. <*errors.StatusError | 0xc0003ef360>")}}},
+		"e2e/changed": {ClassName: "e2e", Name: "changed", Counts: 1, Commits: []string{"b"},
+			Details: []TestDetail{{Count: 1, Error: errors.New("catalog source not found")}}},
+		"e2e/new": {ClassName: "e2e", Name: "new", Counts: 1, Commits: []string{"b"},
+			Details: []TestDetail{{Count: 1, Error: errors.New("configmaps \"mock-ocs\" already exists")}}},
+	}
+	report.ClassifyAgainst(&Baseline{branch: "master", days: 7, history: history.flakeTestMap})
+
+	assert.Equal(t, "known flake (failed 12× on master in the last 7 days)",
+		report.baseline.label(TestEntry{ClassName: "e2e", Name: "flake"}))
+	assert.Equal(t, "known test, new error (failed 3× on master in the last 7 days with other errors)",
+		report.baseline.label(TestEntry{ClassName: "e2e", Name: "changed"}))
+	assert.Equal(t, "new failure, not seen on master in the last 7 days",
+		report.baseline.label(TestEntry{ClassName: "e2e", Name: "new"}))
+	assert.Equal(t, "Compared with master in the last 7 days: 1 known flake, 1 known test with a new error and 1"+
+		" new failure. Known flakes are likely to pass on a retest, new failures likely need a fix.",
+		report.baseline.summary())
+	assert.Empty(t, NewFlakeReport().baseline.label(TestEntry{ClassName: "e2e", Name: "flake"}))
+
+	tests, ok := report.KnownFlakesOn("a")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"flake"}, tests)
+	_, ok = report.KnownFlakesOn("b")
+	assert.False(t, ok)
+	_, ok = report.KnownFlakesOn("c")
+	assert.False(t, ok)
+	assert.Equal(t, map[Classification][]string{KnownTestNewError: {"changed"}, NewFailure: {"new"}},
+		report.FailuresOn("b"))
+}
@@ -0,0 +1,92 @@
+package reporter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// explainErrorSize is the length errors are trimmed to around their failure location in test explanations.
+const explainErrorSize = 1000
+
+// Explain describes the failures of a test in the report and, if the report was compared with a branch, on the branch,
+// as markdown. The test is named by its name or by its class name and name separated by a slash. Explain returns false
+// if the test failed neither in the report nor on the branch.
+func (f *FlakeReport) Explain(name string) (string, bool) {
+	test, ok := findTest(f.flakeTestMap, name)
+	var known TestEntry
+	var knownOK bool
+	if f.baseline != nil {
+		known, knownOK = findTest(f.baseline.history, name)
+	}
+	if !ok && !knownOK {
+		return "", false
+	}
+
+	where := ""
+	if f.filter.pullRequest != "" {
+		where = " on this pull request"
+	}
+	var b strings.Builder
+	if ok {
+		fmt.Fprintf(&b, "**%s** (`%s`) %s%s", test.Name, test.ClassName, failures(test), where)
+		if label := f.baseline.label(test); label != "" {
+			fmt.Fprintf(&b, ", classified as %s", label)
+		}
+		b.WriteString(".\n")
+		writeErrors(&b, test, where)
+	} else {
+		fmt.Fprintf(&b, "**%s** (`%s`) did not fail%s.\n", known.Name, known.ClassName, where)
+	}
+	if f.baseline == nil {
+		return b.String(), true
+	}
+
+	b.WriteString("\n")
+	if !knownOK {
+		fmt.Fprintf(&b, "It did not fail on %s in the last %d days.\n", f.baseline.branch, f.baseline.days)
+		return b.String(), true
+	}
+	fmt.Fprintf(&b, "On %s in the last %d days it %s, last on %s.\n", f.baseline.branch, f.baseline.days,
+		failures(known), known.lastFailure.UTC().Format("2006-01-02"))
+	writeErrors(&b, known, " on "+f.baseline.branch)
+	return b.String(), true
+}
+
+// findTest looks a test up by name, or by class name and name separated by a slash.
+func findTest(tests testMap, name string) (TestEntry, bool) {
+	if test, ok := tests[name]; ok {
+		return test, true
+	}
+	var keys []string
+	for key, test := range tests {
+		if test.Name == name {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return TestEntry{}, false
+	}
+	// Tests of the same name in several classes are ambiguous, pick one consistently.
+	sort.Strings(keys)
+	return tests[keys[0]], true
+}
+
+// failures summarizes the failures of a test, e.g. "failed 3× on 2 commits".
+func failures(test TestEntry) string {
+	commits := map[string]bool{}
+	for _, c := range test.Commits {
+		commits[c] = true
+	}
+	return fmt.Sprintf("failed %d× on %s", test.Counts, Plural(len(commits), "commit", "commits"))
+}
+
+func writeErrors(b *strings.Builder, test TestEntry, where string) {
+	for _, d := range test.Details {
+		if d.Error == nil {
+			continue
+		}
+		fmt.Fprintf(b, "\n<details><summary>%s%s</summary>\n\n```\n%s\n```\n</details>\n",
+			Plural(d.Count, "failure", "failures"), where, trimAround(d.Error.Error(), explainErrorSize))
+	}
+}
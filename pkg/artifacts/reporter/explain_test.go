@@ -0,0 +1,47 @@
+package reporter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	history := NewFlakeReport()
+	history.flakeTestMap = testMap{
+		"e2e/flake": {ClassName: "e2e", Name: "flake", Counts: 3, Commits: []string{"x", "y", "y"},
+			lastFailure: time.Date(2020, 10, 13, 8, 0, 0, 0, time.UTC),
+			Details:     []TestDetail{{Count: 3, Error: errors.New("timed out")}}},
+		"e2e/fixed": {ClassName: "e2e", Name: "fixed", Counts: 1, Commits: []string{"z"},
+			lastFailure: time.Date(2020, 10, 12, 8, 0, 0, 0, time.UTC)},
+	}
+
+	report := NewFlakeReport()
+	report.filter.pullRequest = "1641"
+	report.flakeTestMap = testMap{
+		"e2e/flake": {ClassName: "e2e", Name: "flake", Counts: 1, Commits: []string{"a"},
+			Details: []TestDetail{{Count: 1, Error: errors.New("timed out")}}},
+	}
+
+	explanation, ok := report.Explain("flake")
+	assert.True(t, ok)
+	assert.Contains(t, explanation, "**flake** (`e2e`) failed 1× on 1 commit on this pull request.")
+	assert.Contains(t, explanation, "<summary>1 failure on this pull request</summary>")
+	assert.NotContains(t, explanation, "master", "the report was not compared with a branch")
+
+	report.ClassifyAgainst(&Baseline{branch: "master", days: 7, history: history.flakeTestMap})
+	explanation, ok = report.Explain("e2e/flake")
+	assert.True(t, ok)
+	assert.Contains(t, explanation, "classified as known flake (failed 3× on master in the last 7 days)")
+	assert.Contains(t, explanation, "On master in the last 7 days it failed 3× on 2 commits, last on 2020-10-13.")
+	assert.Contains(t, explanation, "<summary>3 failures on master</summary>")
+
+	explanation, ok = report.Explain("fixed")
+	assert.True(t, ok)
+	assert.Contains(t, explanation, "**fixed** (`e2e`) did not fail on this pull request.")
+
+	_, ok = report.Explain("unknown")
+	assert.False(t, ok)
+}
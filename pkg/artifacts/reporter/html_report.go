@@ -4,45 +4,90 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 
-	"gopkg.in/yaml.v3"
+	gh "github.com/google/go-github/v32/github"
 
 	"github.com/operator-framework/flak-analyzer/pkg/github"
 )
 
 var ErrorNothingToReport error = errors.New("no error in test to report")
 
+// CommentMode selects what happens to the report comment already posted for the same test suite on a pull request.
+type CommentMode string
+
+const (
+	// CommentUpdate edits the existing report comment in place, or posts one if there is none yet.
+	CommentUpdate CommentMode = "update"
+	// CommentMinimize posts a new report comment and minimizes the previous ones as outdated.
+	CommentMinimize CommentMode = "minimize"
+	// CommentNew posts a new report comment on every run.
+	CommentNew CommentMode = "new"
+)
+
+func ParseCommentMode(mode string) (CommentMode, error) {
+	switch m := CommentMode(mode); m {
+	case CommentUpdate, CommentMinimize, CommentNew:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown comment mode %q, must be one of %s, %s or %s", mode, CommentUpdate,
+		CommentMinimize, CommentNew)
+}
+
+const (
+	historyMarker       = "<!-- flake-analyzer history -->"
+	previousReportStart = "<!-- flake-analyzer previous -->"
+	previousReportEnd   = "<!-- /flake-analyzer previous -->"
+)
+
+var previousReport = regexp.MustCompile(`(?s)` + previousReportStart + `\n(.*?)\n` + previousReportEnd)
+
+// reportMarker is the hidden first line of every report comment. It identifies the comment of a test suite on later
+// runs.
+func reportMarker(testsuite string) string {
+	if testsuite == "" {
+		return "<!-- flake-analyzer report -->"
+	}
+	return fmt.Sprintf("<!-- flake-analyzer report: %s -->", testsuite)
+}
+
 type HtmlFlakeReport struct {
-	TotalTestCount   int             `json:"total_test_count",omitempty` // All imported test reports have failures
-	FailedTestCount  int             `json:"failed_test_count",omitempty`
-	FlakeTestCount   int             `json:"flake_test_count",omitempty`   // Number of test suit report
-	SkippedTestCount int             `json:"skipped_test_count",omitempty` // Number of test suit report
-	FlakeTests       []HtmlTestEntry `json:"flake_tests",omitempty`        // Sorted by counts and number of commits
-	SkippedTests     []HtmlTestEntry `json:"skipped_tests",omitempty`
+	TotalTestCount   int             `json:"total_test_count,omitempty"` // All imported test reports have failures
+	FailedTestCount  int             `json:"failed_test_count,omitempty"`
+	FlakeTestCount   int             `json:"flake_test_count,omitempty"`   // Number of test suit report
+	SkippedTestCount int             `json:"skipped_test_count,omitempty"` // Number of test suit report
+	FlakeTests       []HtmlTestEntry `json:"flake_tests,omitempty"`        // Sorted by counts and number of commits
+	SkippedTests     []HtmlTestEntry `json:"skipped_tests,omitempty"`
 }
 
 type HtmlTestEntry struct {
 	ClassName       string           `json:"class_name"`
 	Name            string           `json:"name"`
+	Classification  string           `json:"classification,omitempty" yaml:"classification,omitempty"`
 	Counts          int              `json:"counts"`
-	Details         []HtmlTestDetail `json:"details",omitempty`
+	Details         []HtmlTestDetail `json:"details,omitempty"`
 	MeanDurationSec float64          `json:"mean_duration_sec"`
 }
 
 type HtmlTestDetail struct {
 	Count int    `json:"count"`
-	Error string `json:"error",omitempty`
+	Error string `json:"error,omitempty"`
 }
 
+// PostReportAsPullRequestComment posts the report on the pull request and returns the comment body. By default the
+// report comment of the test suite is updated in place, see WithCommentMode and WithCommentHistory.
 func (f *FlakeReport) PostReportAsPullRequestComment(option ...filterOption) (*string, error) {
+	f.filter.apply(option)
 	if len(f.FlakeTests) == 0 && len(f.SkippedTests) == 0 {
 		if _, err := f.GenerateReport(""); err != nil {
 			return nil, err
 		}
 	}
 
-	if f.filter.token == "" || f.filter.owner == "" || f.filter.repo == "" {
+	if (f.filter.token == "" && !github.HasCredentials(f.filter.clientOptions...)) || f.filter.owner == "" ||
+		f.filter.repo == "" {
 		return nil, fmt.Errorf("posting comments requires GitHub access token, repository owner and name information")
 	}
 
@@ -55,73 +100,138 @@ func (f *FlakeReport) PostReportAsPullRequestComment(option ...filterOption) (*s
 	}
 
 	ctx := context.Background()
-	client := github.NewRepositoryClient(ctx, f.filter.token, f.filter.owner, f.filter.repo, false)
+	client, err := github.NewRepositoryClient(ctx, f.filter.token, f.filter.owner, f.filter.repo, false,
+		f.filter.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
 	pr, err := strconv.Atoi(f.filter.pullRequest)
 	if err != nil {
 		return nil, err
 	}
-	err = client.PostPRComment(ctx, pr, report)
+	body, err := f.postComment(ctx, client, pr, *report)
+
+	return &body, err
+}
+
+func (f *FlakeReport) postComment(ctx context.Context, client *github.RepositoryClient, pr int,
+	report string) (string, error) {
+	marker := reportMarker(f.filter.testsuite)
+	body := marker + "\n" + report
+	var err error
+	if f.filter.commentMode == CommentNew {
+		f.commentID, err = client.CreatePRComment(ctx, pr, &body)
+		return body, err
+	}
+
+	comments, err := client.ListPRComments(ctx, pr)
+	if err != nil {
+		return "", err
+	}
+	// Only comments of the commenter itself are previous reports, anyone could post a comment with the marker.
+	login, err := client.Login(ctx)
+	if err != nil {
+		return "", err
+	}
+	var previous []*gh.IssueComment
+	for _, c := range comments {
+		if c.GetUser().GetLogin() == login && strings.HasPrefix(c.GetBody(), marker+"\n") {
+			previous = append(previous, c)
+		}
+	}
 
-	return report, err
+	if f.filter.commentMode == CommentMinimize || len(previous) == 0 {
+		if f.commentID, err = client.CreatePRComment(ctx, pr, &body); err != nil {
+			return "", err
+		}
+		if f.filter.commentMode != CommentMinimize {
+			return body, nil
+		}
+		var nodeIDs []string
+		for _, c := range previous {
+			nodeIDs = append(nodeIDs, c.GetNodeID())
+		}
+		minimized, err := client.MinimizedComments(ctx, nodeIDs)
+		if err != nil {
+			return "", err
+		}
+		for _, id := range nodeIDs {
+			if minimized[id] {
+				continue
+			}
+			if err := client.MinimizeComment(ctx, id, "OUTDATED"); err != nil {
+				return "", err
+			}
+		}
+		return body, nil
+	}
+
+	latest := previous[len(previous)-1]
+	body = withHistory(body, marker, latest, f.filter.commentHistory)
+	if err := client.EditPRComment(ctx, latest.GetID(), &body); err != nil {
+		return "", err
+	}
+	f.commentID = latest.GetID()
+	return body, nil
+}
+
+// CommentID returns the ID of the comment posted or updated by PostReportAsPullRequestComment, or zero if none was.
+func (f *FlakeReport) CommentID() int64 {
+	return f.commentID
+}
+
+// withHistory appends the report of the previous comment and up to historySize-1 of the reports it kept, newest
+// first, as a collapsed section to body. The oldest reports are left out as needed to fit in a comment.
+func withHistory(body, marker string, previous *gh.IssueComment, historySize int) string {
+	if historySize <= 0 {
+		return body
+	}
+
+	current, history := strings.TrimPrefix(previous.GetBody(), marker+"\n"), ""
+	if i := strings.Index(current, historyMarker); i >= 0 {
+		current, history = current[:i], current[i:]
+	}
+	reports := []string{fmt.Sprintf("<details><summary>Report of %s</summary>\n\n%s\n</details>",
+		previous.GetUpdatedAt().UTC().Format("2006-01-02 15:04 MST"), strings.TrimSpace(current))}
+	for _, match := range previousReport.FindAllStringSubmatch(history, -1) {
+		reports = append(reports, match[1])
+	}
+	if len(reports) > historySize {
+		reports = reports[:historySize]
+	}
+
+	for ; len(reports) > 0; reports = reports[:len(reports)-1] {
+		var b strings.Builder
+		b.WriteString(body)
+		b.WriteString("\n\n" + historyMarker + "\n")
+		fmt.Fprintf(&b, "<details><summary>Previous reports (%d)</summary>\n\n", len(reports))
+		for _, r := range reports {
+			b.WriteString(previousReportStart + "\n" + r + "\n" + previousReportEnd + "\n\n")
+		}
+		b.WriteString("</details>\n")
+		if b.Len() <= maxCommentSize {
+			return b.String()
+		}
+	}
+	return body
 }
 
 func (f *FlakeReport) generateReportComment() (*string, error) {
-	var shortFlakeTests, shortSkippedTests []HtmlTestEntry
-
-	for _, test := range f.FlakeTests {
-		shortFlakeTests = append(shortFlakeTests, HtmlTestEntry{
-			ClassName: test.ClassName,
-			Name:      "**" + test.Name + "**",
-			Counts:    test.Counts,
-			Details: func() (details []HtmlTestDetail) {
-				for _, d := range test.Details {
-					details = append(details, HtmlTestDetail{
-						Count: d.Count,
-						Error: "\n\n" + d.Error.Error(),
-					})
-				}
-				return
-			}(),
-			MeanDurationSec: test.MeanDurationSec,
-		})
-	}
-
-	for _, test := range f.SkippedTests {
-		shortSkippedTests = append(shortSkippedTests, HtmlTestEntry{
-			ClassName: test.ClassName,
-			Name:      "**" + test.Name + "**",
-			Counts:    test.Counts,
-			Details: func() (details []HtmlTestDetail) {
-				for _, d := range test.Details {
-					details = append(details, HtmlTestDetail{
-						Count: d.Count,
-						Error: d.Error.Error(),
-					})
-				}
-				return
-			}(),
-			MeanDurationSec: test.MeanDurationSec,
-		})
-	}
-
-	if shortFlakeTests == nil && shortSkippedTests == nil {
+	if len(f.FlakeTests) == 0 && len(f.SkippedTests) == 0 {
 		return nil, ErrorNothingToReport
 	}
 
-	data, err := yaml.Marshal(HtmlFlakeReport{
-		TotalTestCount: f.TotalTestCount,
-		FailedTestCount:f.FailedTestCount,
-		FlakeTestCount:   f.FlakeTestCount,
-		SkippedTestCount: f.SkippedTestCount,
-		FlakeTests:       shortFlakeTests,
-		SkippedTests:     shortSkippedTests,
-	})
+	t := f.filter.commentTemplate
+	if t == nil {
+		var err error
+		if t, err = LoadTemplate(TemplateDetailed); err != nil {
+			return nil, err
+		}
+	}
+	// The report marker is added in front of the report.
+	report, err := fitComment(t, f.templateData(), maxCommentSize-len(reportMarker(f.filter.testsuite))-1)
 	if err != nil {
 		return nil, err
 	}
-
-	report := fmt.Sprintf("This PR **failed %d out of %d times** with %d individual failed tests and %d" +
-		" skipped tests. A test is considered flaky if failed on multiple commits. \n<details>\n\n %v",
-		f.FailedTestCount,f.TotalTestCount, f.FlakeTestCount, f.SkippedTestCount, string(data))
 	return &report, nil
 }
@@ -0,0 +1,293 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	gh "github.com/google/go-github/v32/github"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/operator-framework/flak-analyzer/pkg/github"
+)
+
+const (
+	// maxIssueTitle is the length limit of issue titles.
+	maxIssueTitle = 256
+	// maxIssueError is the length each error variant may take up in an issue body or comment.
+	maxIssueError = 8000
+	// maxRecentCommits is the number of commits listed as recent occurrences in an issue.
+	maxRecentCommits = 10
+)
+
+// IssuePolicy configures how SyncIssues files issues for flaky tests.
+type IssuePolicy struct {
+	// Threshold is the number of failures in the report from which an issue is opened for a test.
+	Threshold int
+	// CloseAfterDays resolves the issue of a test that has not failed for that many days. Zero never resolves issues.
+	CloseAfterDays int
+	// Labels are added to new issues. Only issues carrying all of them are considered.
+	Labels []string
+	// ResolvedLabel is added to resolved issues instead of closing them.
+	ResolvedLabel string
+}
+
+// IssueSummary counts the issues changed by SyncIssues.
+type IssueSummary struct {
+	Created  int
+	Updated  int
+	Reopened int
+	Resolved int
+}
+
+// issueState is kept as JSON in a hidden marker at the top of an issue body. It identifies the test of the issue and
+// remembers what has been reported so far.
+type issueState struct {
+	Test         string    `json:"test"`
+	TestSuite    string    `json:"test_suite,omitempty"`
+	Fingerprints []string  `json:"fingerprints"`
+	LastFailure  time.Time `json:"last_failure"`
+}
+
+var issueMarker = regexp.MustCompile(`^<!-- flake-analyzer issue: (\{.*?\}) -->`)
+
+func parseIssueState(body string) (*issueState, bool) {
+	match := issueMarker.FindStringSubmatch(body)
+	if match == nil {
+		return nil, false
+	}
+	state := &issueState{}
+	if err := json.Unmarshal([]byte(match[1]), state); err != nil {
+		return nil, false
+	}
+	return state, true
+}
+
+// SyncIssues maintains one issue per flaky test of the report. Tests failing at least policy.Threshold times get an
+// issue, existing issues are updated with fresh counts and recent occurrences, new error variants are commented on,
+// and issues of tests that have not failed for policy.CloseAfterDays are resolved. Resolved issues are reopened when
+// their test fails again.
+func (f *FlakeReport) SyncIssues(policy IssuePolicy) (*IssueSummary, error) {
+	if len(f.FlakeTests) == 0 && len(f.SkippedTests) == 0 {
+		if _, err := f.GenerateReport(""); err != nil {
+			return nil, err
+		}
+	}
+
+	if (f.filter.token == "" && !github.HasCredentials(f.filter.clientOptions...)) || f.filter.owner == "" ||
+		f.filter.repo == "" {
+		return nil, fmt.Errorf("managing issues requires GitHub access token, repository owner and name information")
+	}
+
+	ctx := context.Background()
+	client, err := github.NewRepositoryClient(ctx, f.filter.token, f.filter.owner, f.filter.repo, false,
+		f.filter.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	issues, err := client.ListIssues(ctx, policy.Labels)
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]*gh.Issue{}
+	states := map[string]*issueState{}
+	for _, issue := range issues {
+		state, ok := parseIssueState(issue.GetBody())
+		if !ok || state.TestSuite != f.filter.testsuite {
+			continue
+		}
+		// Prefer the open issue if a test was filed more than once.
+		if existing, ok := tracked[state.Test]; ok && existing.GetState() == "open" {
+			continue
+		}
+		tracked[state.Test] = issue
+		states[state.Test] = state
+	}
+
+	now := time.Now()
+	summary := &IssueSummary{}
+	for _, test := range f.FlakeTests {
+		key := test.ClassName + "/" + test.Name
+		lastFailure := test.lastFailure
+		if lastFailure.IsZero() {
+			lastFailure = now
+		}
+		resolved := policy.CloseAfterDays > 0 && now.Sub(lastFailure) >= time.Duration(policy.CloseAfterDays)*24*time.Hour
+
+		issue, ok := tracked[key]
+		if !ok {
+			if test.Counts < policy.Threshold || resolved {
+				continue
+			}
+			state := &issueState{Test: key, TestSuite: f.filter.testsuite, Fingerprints: testFingerprints(test),
+				LastFailure: lastFailure}
+			body, err := f.issueBody(test, state)
+			if err != nil {
+				return nil, err
+			}
+			issue, err := client.CreateIssue(ctx, truncate("Flaky test: "+test.Name, maxIssueTitle), body, policy.Labels)
+			if err != nil {
+				return nil, err
+			}
+			log.Infof("Opened issue #%d for flaky test %s", issue.GetNumber(), key)
+			summary.Created++
+			continue
+		}
+		delete(tracked, key)
+
+		state := states[key]
+		failedAgain := lastFailure.After(state.LastFailure)
+		known := map[string]bool{}
+		for _, fp := range state.Fingerprints {
+			known[fp] = true
+		}
+		var variants []TestDetail
+		for _, d := range test.Details {
+			if fp := fingerprint(d.Error); !known[fp] {
+				known[fp] = true
+				state.Fingerprints = append(state.Fingerprints, fp)
+				variants = append(variants, d)
+			}
+		}
+		if failedAgain {
+			state.LastFailure = lastFailure
+		}
+
+		body, err := f.issueBody(test, state)
+		if err != nil {
+			return nil, err
+		}
+		request := &gh.IssueRequest{Body: gh.String(body)}
+		open := issue.GetState() == "open" && !hasLabel(issue, policy.ResolvedLabel)
+		switch {
+		case open && resolved:
+			if err := resolveIssue(ctx, client, issue, policy); err != nil {
+				return nil, err
+			}
+			summary.Resolved++
+		case !open && failedAgain && !resolved:
+			if err := client.PostPRComment(ctx, issue.GetNumber(), gh.String(fmt.Sprintf(
+				"The test failed again on %s, reopening.", lastFailure.UTC().Format("2006-01-02")))); err != nil {
+				return nil, err
+			}
+			if issue.GetState() != "open" {
+				request.State = gh.String("open")
+			}
+			if hasLabel(issue, policy.ResolvedLabel) {
+				if err := client.RemoveLabel(ctx, issue.GetNumber(), policy.ResolvedLabel); err != nil {
+					return nil, err
+				}
+			}
+			summary.Reopened++
+		default:
+			summary.Updated++
+		}
+		if err := client.EditIssue(ctx, issue.GetNumber(), request); err != nil {
+			return nil, err
+		}
+
+		for _, d := range variants {
+			if d.Error == nil {
+				continue
+			}
+			comment := fmt.Sprintf("New error variant, failed %d times:\n\n```\n%s\n```", d.Count,
+				truncate(strings.TrimSpace(d.Error.Error()), maxIssueError))
+			if err := client.PostPRComment(ctx, issue.GetNumber(), &comment); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The tests of the remaining issues did not fail in the analyzed period.
+	for key, issue := range tracked {
+		state := states[key]
+		if issue.GetState() != "open" || hasLabel(issue, policy.ResolvedLabel) || policy.CloseAfterDays <= 0 ||
+			now.Sub(state.LastFailure) < time.Duration(policy.CloseAfterDays)*24*time.Hour {
+			continue
+		}
+		if err := resolveIssue(ctx, client, issue, policy); err != nil {
+			return nil, err
+		}
+		summary.Resolved++
+	}
+
+	log.Infof("Flaky test issues: %d opened, %d updated, %d reopened, %d resolved", summary.Created, summary.Updated,
+		summary.Reopened, summary.Resolved)
+	return summary, nil
+}
+
+func resolveIssue(ctx context.Context, client *github.RepositoryClient, issue *gh.Issue, policy IssuePolicy) error {
+	comment := fmt.Sprintf("The test has not failed in the last %d days, resolving. The issue is reopened if it fails"+
+		" again.", policy.CloseAfterDays)
+	if err := client.PostPRComment(ctx, issue.GetNumber(), &comment); err != nil {
+		return err
+	}
+	log.Infof("Resolving issue #%d", issue.GetNumber())
+	if policy.ResolvedLabel != "" {
+		return client.AddLabels(ctx, issue.GetNumber(), policy.ResolvedLabel)
+	}
+	return client.EditIssue(ctx, issue.GetNumber(), &gh.IssueRequest{State: gh.String("closed")})
+}
+
+func hasLabel(issue *gh.Issue, label string) bool {
+	if label == "" {
+		return false
+	}
+	for _, l := range issue.Labels {
+		if l.GetName() == label {
+			return true
+		}
+	}
+	return false
+}
+
+func testFingerprints(test TestEntry) []string {
+	var fingerprints []string
+	for _, d := range test.Details {
+		fingerprints = append(fingerprints, fingerprint(d.Error))
+	}
+	return fingerprints
+}
+
+func (f *FlakeReport) issueBody(test TestEntry, state *issueState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- flake-analyzer issue: %s -->\n", data)
+	fmt.Fprintf(&b, "`%s` of `%s` failed **%d times** on %d commits", test.Name, test.ClassName, test.Counts,
+		len(test.Commits))
+	if f.filter.from != nil {
+		fmt.Fprintf(&b, " since %s", f.filter.from.UTC().Format("2006-01-02"))
+	}
+	fmt.Fprintf(&b, ". It last failed on %s.\n", state.LastFailure.UTC().Format("2006-01-02 15:04 MST"))
+	if f.filter.testsuite != "" {
+		fmt.Fprintf(&b, "\nTest suite: `%s`\n", f.filter.testsuite)
+	}
+
+	b.WriteString("\n### Recent Occurrences\n\n")
+	commits := test.Commits
+	if len(commits) > maxRecentCommits {
+		commits = commits[len(commits)-maxRecentCommits:]
+	}
+	for _, c := range commits {
+		fmt.Fprintf(&b, "* %s\n", c)
+	}
+
+	b.WriteString("\n### Errors\n")
+	for _, d := range test.Details {
+		if d.Error == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "\n<details><summary>Failed %d times</summary>\n\n```\n%s\n```\n</details>\n", d.Count,
+			truncate(strings.TrimSpace(d.Error.Error()), maxIssueError))
+	}
+	b.WriteString("\nThis issue is maintained by the flake analyzer, edits of the description are overwritten.\n")
+	return truncate(b.String(), maxCheckRunText), nil
+}
@@ -0,0 +1,32 @@
+package reporter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueBodyState(t *testing.T) {
+	lastFailure := time.Date(2020, 10, 13, 8, 0, 0, 0, time.UTC)
+	test := TestEntry{ClassName: "e2e", Name: "installs <csv> & waits", Counts: 2,
+		Commits: []string{"2dee293e", "5a1aecd1"},
+		Details: []TestDetail{{Count: 2, Error: errors.New("Timed out after 60.000s. --> <-- `done`")}}}
+	state := &issueState{Test: "e2e/" + test.Name, TestSuite: "e2e", Fingerprints: testFingerprints(test),
+		LastFailure: lastFailure}
+
+	body, err := NewFlakeReport().issueBody(test, state)
+	require.NoError(t, err)
+	assert.Contains(t, body, "failed **2 times** on 2 commits")
+
+	parsed, ok := parseIssueState(body)
+	require.True(t, ok)
+	assert.Equal(t, state.Test, parsed.Test)
+	assert.Equal(t, state.Fingerprints, parsed.Fingerprints)
+	assert.True(t, lastFailure.Equal(parsed.LastFailure))
+
+	_, ok = parseIssueState("Flaky test reported by hand")
+	assert.False(t, ok)
+}
@@ -0,0 +1,170 @@
+package reporter
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// maxCommentSize is the length limit of issue and pull request comments. GitHub counts characters, the limit is
+// applied to bytes to stay on the safe side.
+const maxCommentSize = 65536
+
+// errorWindows are the lengths errors are trimmed to, around their failure location, when a comment is too long.
+var errorWindows = []int{4000, 1000, 300}
+
+// ActionsRunURL returns the URL of the GitHub Actions workflow run the analyzer runs in, or an empty string outside
+// of GitHub Actions.
+func ActionsRunURL() string {
+	server, repo, run := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server == "" || repo == "" || run == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, run)
+}
+
+// fitComment renders data with t in at most limit bytes. If the full report is too long, errors are trimmed around
+// their failure location first, then the least important tests are left out and a note links to the full report.
+func fitComment(t *template.Template, data TemplateData, limit int) (string, error) {
+	out, err := render(t, data)
+	if err != nil {
+		return "", err
+	}
+	if len(out) <= limit {
+		return string(out), nil
+	}
+
+	data.FlakeTests = prioritize(data.FlakeTests)
+	data.SkippedTests = append([]TemplateTest(nil), data.SkippedTests...)
+	for _, n := range errorWindows {
+		data.FlakeTests = trimErrors(data.FlakeTests, n)
+		data.SkippedTests = trimErrors(data.SkippedTests, n)
+		if out, err = render(t, data); err != nil {
+			return "", err
+		}
+		if len(out) <= limit {
+			return string(out), nil
+		}
+	}
+
+	// Find the fewest tests to leave out, skipped tests before failed ones, by bisection. Each render leaving out more
+	// tests is shorter, save for the digits of the note.
+	flakes, skipped := data.FlakeTests, data.SkippedTests
+	total := len(flakes) + len(skipped)
+	if total == 0 {
+		// Without tests to leave out, the summary alone is too long, e.g. with a custom template.
+		return truncate(string(out), limit), nil
+	}
+	omit := func(n int) (string, error) {
+		data.SkippedTests = skipped[:len(skipped)-min(n, len(skipped))]
+		data.FlakeTests = flakes[:len(flakes)-max(n-len(skipped), 0)]
+		out, err := render(t, data)
+		return string(out) + omittedNote(n, data.ReportURL), err
+	}
+	low, high := 1, total
+	for low < high {
+		mid := (low + high) / 2
+		comment, err := omit(mid)
+		if err != nil {
+			return "", err
+		}
+		if len(comment) <= limit {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	comment, err := omit(low)
+	if err != nil {
+		return "", err
+	}
+	if len(comment) > limit {
+		// Even the summary alone is too long.
+		note := omittedNote(total, data.ReportURL)
+		comment = truncate(strings.TrimSuffix(comment, note), limit-len(note)) + note
+	}
+	return comment, nil
+}
+
+func omittedNote(n int, reportURL string) string {
+	note := fmt.Sprintf("\n\n_%s omitted to fit in a comment", Plural(n, "more test", "more tests"))
+	if reportURL != "" {
+		note += fmt.Sprintf(", see the [full report](%s)", reportURL)
+	}
+	return note + "._"
+}
+
+// prioritize orders failed tests by importance: new failures before known tests with new errors before known flakes,
+// then by the number of failures and commits.
+func prioritize(tests []TemplateTest) []TemplateTest {
+	rank := func(t TemplateTest) int {
+		switch {
+		case strings.HasPrefix(t.Classification, string(NewFailure)):
+			return 0
+		case strings.HasPrefix(t.Classification, string(KnownFlake)):
+			return 2
+		default:
+			return 1
+		}
+	}
+	sorted := append([]TemplateTest(nil), tests...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ri, rj := rank(sorted[i]), rank(sorted[j]); ri != rj {
+			return ri < rj
+		}
+		if sorted[i].Counts != sorted[j].Counts {
+			return sorted[i].Counts > sorted[j].Counts
+		}
+		return len(sorted[i].Commits) > len(sorted[j].Commits)
+	})
+	return sorted
+}
+
+func trimErrors(tests []TemplateTest, n int) []TemplateTest {
+	trimmed := make([]TemplateTest, len(tests))
+	for i, test := range tests {
+		test.Details = append([]TemplateDetail(nil), test.Details...)
+		for j := range test.Details {
+			test.Details[j].Error = trimAround(test.Details[j].Error, n)
+		}
+		trimmed[i] = test
+	}
+	return trimmed
+}
+
+// trimAround shortens a failure body to about n bytes around its failure location, or to its beginning if it has
+// none.
+func trimAround(body string, n int) string {
+	if len(body) <= n {
+		return body
+	}
+	start := 0
+	if _, _, i, ok := failureLocationIndex(body); ok {
+		start = max(i-n/4, 0)
+	}
+	start = min(start, len(body)-n)
+	trimmed := strings.ToValidUTF8(body[start:start+n], "")
+	if start > 0 {
+		trimmed = "...\n" + trimmed
+	}
+	if start+n < len(body) {
+		trimmed += "\n..."
+	}
+	return trimmed
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package reporter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitComment(t *testing.T) {
+	tmpl, err := LoadTemplate(TemplateDetailed)
+	require.NoError(t, err)
+
+	data := TemplateData{PullRequest: "1641", ReportURL: "https://github.com/o/r/actions/runs/1"}
+	for i := 0; i < 200; i++ {
+		data.FlakeTests = append(data.FlakeTests, TemplateTest{ClassName: "e2e", Name: fmt.Sprintf("flake %d", i),
+			Classification: "known flake", Counts: 200 - i,
+			Details: []TemplateDetail{{Count: 1, Error: strings.Repeat("log line\n", 1000) +
+				"/home/runner/work/olm/olm/test/e2e/gc_e2e_test.go:481\nTimed out"}}})
+	}
+	data.FlakeTests = append(data.FlakeTests, TemplateTest{ClassName: "e2e", Name: "new", Classification: "new failure",
+		Counts: 1, Details: []TemplateDetail{{Count: 1, Error: "catalog source not found"}}})
+
+	comment, err := fitComment(tmpl, data, maxCommentSize)
+	require.NoError(t, err)
+	assert.True(t, len(comment) <= maxCommentSize, "comment of %d bytes", len(comment))
+	assert.Contains(t, comment, "more tests omitted to fit in a comment, see the [full report]("+data.ReportURL+")._")
+	assert.True(t, strings.Index(comment, "'**new**'") < strings.Index(comment, "'**flake 0**'"),
+		"new failures come first")
+	assert.Contains(t, comment, "test/e2e/gc_e2e_test.go:481")
+	assert.NotContains(t, comment, "'**flake 199**'")
+
+	small, err := fitComment(tmpl, TemplateData{FlakeTests: data.FlakeTests[:1]}, maxCommentSize)
+	require.NoError(t, err)
+	assert.NotContains(t, small, "omitted")
+
+	long, err := template.New("long").Parse(strings.Repeat("{{.PullRequest}} ", 100))
+	require.NoError(t, err)
+	truncated, err := fitComment(long, TemplateData{PullRequest: "1641"}, 100)
+	require.NoError(t, err)
+	assert.Len(t, truncated, 100)
+	assert.True(t, strings.HasSuffix(truncated, "..."), "truncated comment %q", truncated)
+}
+
+func TestTrimAround(t *testing.T) {
+	body := strings.Repeat("a", 1000) + "\n/home/runner/work/olm/olm/test/e2e/gc_e2e_test.go:481" + strings.Repeat("b", 1000)
+	trimmed := trimAround(body, 400)
+	assert.True(t, strings.HasPrefix(trimmed, "...\n"))
+	assert.True(t, strings.HasSuffix(trimmed, "\n..."))
+	assert.Contains(t, trimmed, "gc_e2e_test.go:481")
+	assert.Equal(t, "short", trimAround("short", 400))
+	assert.Equal(t, strings.Repeat("c", 400)+"\n...", trimAround(strings.Repeat("c", 1000), 400))
+}
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/joshdk/go-junit"
@@ -26,11 +27,14 @@ type FlakeReport struct {
 	FailedTestCount      int         `json:"failed_test_count"`     // All imported test reports have failures
 	FlakeTestCount       int         `json:"flake_test_count"`      // Number of test suit report
 	SkippedTestCount     int         `json:"skipped_test_count"`    // Number of test suit report
-	FlakeTests           []TestEntry `json:"flake_tests",omitempty` // Sorted by counts and number of commits
-	SkippedTests         []TestEntry `json:"skipped_tests",omitempty`
+	FlakeTests           []TestEntry `json:"flake_tests,omitempty"` // Sorted by counts and number of commits
+	SkippedTests         []TestEntry `json:"skipped_tests,omitempty"`
 	flakeTestMap         testMap     // map[class name + test name]TestEntry
 	skippedTestMap       testMap
 	mostRecentTestFailed bool // boolean to indicate if the latest test failed
+	baseline             *baseline
+	// commentID is the ID of the pull request comment the report was posted as.
+	commentID int64
 }
 
 type testMap map[string]TestEntry
@@ -39,16 +43,17 @@ type TestEntry struct {
 	ClassName       string       `json:"class_name"`
 	Name            string       `json:"name"`
 	Counts          int          `json:"counts"`
-	Details         []TestDetail `json:"details",omitempty`
+	Details         []TestDetail `json:"details,omitempty"`
 	Commits         []string     `json:"commits"`
 	MeanDurationSec float64      `json:"mean_duration_sec"`
+	lastFailure     time.Time
 }
 
 type TestDetail struct {
 	Count     int    `json:"count"`
-	Error     error  `json:"error",omitempty`
-	SystemOut string `json:"system_out",omitempty`
-	SystemErr string `json:"system_err",omitempty`
+	Error     error  `json:"error,omitempty"`
+	SystemOut string `json:"system_out,omitempty"`
+	SystemErr string `json:"system_err,omitempty"`
 }
 
 type reportFilter struct {
@@ -57,10 +62,19 @@ type reportFilter struct {
 	token             string
 	testsuite         string
 	commit            string
+	headSHA           string
+	branch            string
 	pullRequest       string
 	localPath         string
 	tmpDir            string
 	waitForQuotaReset bool
+	clientOptions     []github.ClientOption
+	commentMode       CommentMode
+	commentHistory    int
+	commentTemplate   *template.Template
+	reportTemplate    *template.Template
+	reportURL         string
+	testOwners        func(test TestEntry) []string
 }
 
 type filterOption func(filter *reportFilter)
@@ -128,6 +142,20 @@ func FilterPR(pr string) filterOption {
 	}
 }
 
+// FilterBranch only includes test results of the workflow runs on a branch, e.g. the main branch.
+func FilterBranch(branch string) filterOption {
+	return func(filter *reportFilter) {
+		filter.branch = branch
+	}
+}
+
+// WithHeadSHA sets the commit check runs are published on instead of the head commit of the pull request.
+func WithHeadSHA(sha string) filterOption {
+	return func(filter *reportFilter) {
+		filter.headSHA = sha
+	}
+}
+
 func ImportFromLocalDirectory(dir string) filterOption {
 	return func(filter *reportFilter) {
 		filter.localPath = dir
@@ -141,6 +169,59 @@ func WithTempDownloadDir(tmpDir string) filterOption {
 	}
 }
 
+// WithClientOptions configures the GitHub clients used to download artifacts and post comments.
+func WithClientOptions(options ...github.ClientOption) filterOption {
+	return func(filter *reportFilter) {
+		filter.clientOptions = append(filter.clientOptions, options...)
+	}
+}
+
+// WithCommentMode selects how the pull request report comment is posted, see CommentMode.
+func WithCommentMode(mode CommentMode) filterOption {
+	return func(filter *reportFilter) {
+		filter.commentMode = mode
+	}
+}
+
+// WithCommentHistory keeps up to n previous reports collapsed below the current one when the report comment is
+// updated in place.
+func WithCommentHistory(n int) filterOption {
+	return func(filter *reportFilter) {
+		filter.commentHistory = n
+	}
+}
+
+// WithCommentTemplate renders pull request comments with a template, see LoadTemplate. The detailed template is used
+// by default.
+func WithCommentTemplate(t *template.Template) filterOption {
+	return func(filter *reportFilter) {
+		filter.commentTemplate = t
+	}
+}
+
+// WithReportTemplate renders the report file with a template, see LoadTemplate, instead of writing it as YAML.
+func WithReportTemplate(t *template.Template) filterOption {
+	return func(filter *reportFilter) {
+		filter.reportTemplate = t
+	}
+}
+
+// WithReportURL links comments that are too long to post in full to the full report, e.g. the workflow run that
+// uploads it.
+func WithReportURL(url string) filterOption {
+	return func(filter *reportFilter) {
+		filter.reportURL = url
+	}
+}
+
+// WithTestOwners mentions the owners of the failed tests in comments. owners returns the GitHub logins of the owners
+// of a test.
+func WithTestOwners(owners func(test TestEntry) []string) filterOption {
+	return func(filter *reportFilter) {
+		filter.testOwners = owners
+	}
+}
+
 func (r *reportFilter) apply(options []filterOption) {
 	for _, option := range options {
 		option(r)
@@ -152,8 +233,8 @@ func (r *reportFilter) complete() error {
 		return fmt.Errorf("please supply either owner, repository name, and filter info or report artifact directory")
 	}
 
-	if r.owner != "" && r.repo != "" && r.token == "" {
-		return fmt.Errorf("please supply token for pulling artifacts from Github %s/%s", r.owner, r.repo)
+	if r.owner != "" && r.repo != "" && r.token == "" && !github.HasCredentials(r.clientOptions...) {
+		return fmt.Errorf("please supply token or GitHub App credentials for pulling artifacts from Github %s/%s", r.owner, r.repo)
 	}
 
 	if r.tmpDir == "" {
@@ -186,7 +267,11 @@ func (f *FlakeReport) LoadReport(option ...filterOption) error {
 		ctx := context.Background()
 
 		// Download from Github
-		client := github.NewRepositoryClient(ctx, f.filter.token, f.filter.owner, f.filter.repo, f.filter.waitForQuotaReset)
+		client, err := github.NewRepositoryClient(ctx, f.filter.token, f.filter.owner, f.filter.repo,
+			f.filter.waitForQuotaReset, f.filter.clientOptions...)
+		if err != nil {
+			return err
+		}
 		arlist, err := client.ListAllArtifacts(ctx)
 		if err != nil {
 			return err
@@ -207,6 +292,21 @@ func (f *FlakeReport) LoadReport(option ...filterOption) error {
 			f.filter.commit = strings.Join(commits, "|")
 		}
 
+		if f.filter.branch != "" {
+			commits, err := client.ListBranchHeadSHAs(ctx, f.filter.branch, f.filter.from)
+			if err != nil {
+				return err
+			}
+			if len(commits) == 0 {
+				// Nothing ran on the branch, so no artifact may match.
+				arlist = nil
+			}
+			if f.filter.commit != "" {
+				commits = append(commits, f.filter.commit)
+			}
+			f.filter.commit = strings.Join(commits, "|")
+		}
+
 		var pattern string
 		if f.filter.testsuite != "" && f.filter.commit != "" {
 			pattern = f.filter.testsuite + "-(" + f.filter.commit + ")"
@@ -268,6 +368,26 @@ func (f *FlakeReport) LoadReport(option ...filterOption) error {
 	return nil
 }
 
+// RemoveTests leaves the tests for which remove returns true out of the report, e.g. the tests a repository ignores,
+// and returns the names of the failed tests left out. failed tells failed tests from skipped ones. The numbers of
+// test reports are kept. RemoveTests must be called before the report is generated or compared with a branch.
+func (f *FlakeReport) RemoveTests(remove func(test TestEntry, failed bool) bool) []string {
+	var removed []string
+	for key, test := range f.flakeTestMap {
+		if remove(test, true) {
+			delete(f.flakeTestMap, key)
+			removed = append(removed, test.Name)
+		}
+	}
+	for key, test := range f.skippedTestMap {
+		if remove(test, false) {
+			delete(f.skippedTestMap, key)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
 // GenerateReport sorts the report and converts the tests from map to arrays for print out. It generates a yaml report.
 func (f *FlakeReport) GenerateReport(outputFile string) ([]byte, error) {
 	for _, test := range f.flakeTestMap {
@@ -290,7 +410,13 @@ func (f *FlakeReport) GenerateReport(outputFile string) ([]byte, error) {
 		return f.SkippedTests[i].Counts > f.SkippedTests[j].Counts && len(f.SkippedTests[i].Commits) > len(f.SkippedTests[j].Commits)
 	})
 
-	data, err := yaml.Marshal(f)
+	var data []byte
+	var err error
+	if f.filter.reportTemplate != nil {
+		data, err = render(f.filter.reportTemplate, f.templateData())
+	} else {
+		data, err = yaml.Marshal(f)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -329,10 +455,10 @@ func (f *FlakeReport) addTests(dir string) error {
 				case junit.StatusPassed:
 					continue
 				case junit.StatusSkipped:
-					f.skippedTestMap.loadTestEntries(t, ar.commit)
+					f.skippedTestMap.loadTestEntries(t, ar.commit, ar.createdAt)
 				default:
 					// failed or errored
-					f.flakeTestMap.loadTestEntries(t, ar.commit)
+					f.flakeTestMap.loadTestEntries(t, ar.commit, ar.createdAt)
 				}
 			}
 		}
@@ -345,7 +471,7 @@ func (f *FlakeReport) addTests(dir string) error {
 	return nil
 }
 
-func (t *testMap) loadTestEntries(test junit.Test, commit string) {
+func (t *testMap) loadTestEntries(test junit.Test, commit string, createdAt time.Time) {
 	testName := test.Classname + "/" + test.Name
 	if existing, ok := (*t)[testName]; !ok {
 		(*t)[testName] = TestEntry{
@@ -354,6 +480,7 @@ func (t *testMap) loadTestEntries(test junit.Test, commit string) {
 			Name:            test.Name,
 			ClassName:       test.Classname,
 			MeanDurationSec: test.Duration.Seconds(),
+			lastFailure:     createdAt,
 			Details: func() []TestDetail {
 				if test.Error == nil && test.SystemOut == "" && test.SystemErr == "" {
 					return nil
@@ -376,6 +503,12 @@ func (t *testMap) loadTestEntries(test junit.Test, commit string) {
 			Name:            test.Name,
 			ClassName:       test.Classname,
 			MeanDurationSec: (test.Duration.Seconds()-existing.MeanDurationSec)/float64(existing.Counts+1) + existing.MeanDurationSec,
+			lastFailure: func() time.Time {
+				if createdAt.After(existing.lastFailure) {
+					return createdAt
+				}
+				return existing.lastFailure
+			}(),
 			Details: func() []TestDetail {
 				if test.Error == nil && test.SystemOut == "" && test.SystemErr == "" {
 					return existing.Details
@@ -1,10 +1,19 @@
 package reporter
 
 import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/flak-analyzer/pkg/github"
+	"github.com/operator-framework/flak-analyzer/pkg/github/fake"
+	"github.com/operator-framework/flak-analyzer/pkg/github/recorder"
 )
 
 const (
@@ -35,15 +44,33 @@ func TestGeneratingNewFlakeReport(t *testing.T) {
 }
 
 func TestGeneratingFlakeReportFromOnline(t *testing.T) {
+	mode := recorder.ModeFromEnv()
+	rec, err := recorder.New("./testData/fixtures/flake-report-from-online.yaml", mode, nil)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, rec.Stop()) }()
+
+	dir, err := ioutil.TempDir("", "online-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
 	report := NewFlakeReport()
-	err := report.LoadReport(RepositoryInfo(owner, repo),WithToken(""),FilterFromDaysAgo(3),
-		FilterCommit("08c4c923c66c9d78895847c5b7e1a21c8887d89c|f5f69155b5c13b94ec56c42dc5e2ffc4236f543b"))
+	err = report.LoadReport(RepositoryInfo(owner, repo), WithToken(recorder.Token(mode)),
+		FilterFrom(time.Date(2020, time.July, 8, 0, 0, 0, 0, time.UTC)), FilterTestSuite("e2e-test-output"),
+		FilterPR("1641"), WithTempDownloadDir(dir), WithClientOptions(github.WithTransport(rec)))
 	assert.NoError(t, err)
 
-	data, err := report.GenerateReport("./online/report.yaml")
+	data, err := report.GenerateReport(filepath.Join(dir, "report.yaml"))
 	assert.NoError(t, err)
 	assert.NotEmpty(t, data)
 
-	_, err = report.PostReportAsPullRequestComment()
-	assert.NoError(t, err)
+	// The comment is posted to a fake, so that recording the fixture never comments on the upstream repository.
+	s := fake.NewServer()
+	defer s.Close()
+	s.AddPullRequest(owner, repo, 1641)
+	_, err = report.PostReportAsPullRequestComment(WithClientOptions(github.WithTransport(http.DefaultTransport),
+		github.WithEnterpriseURLs(s.URL, "")))
+	require.NoError(t, err)
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Body, "This PR **failed 2 out of 2 times**")
 }
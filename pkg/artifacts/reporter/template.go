@@ -0,0 +1,237 @@
+package reporter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateData is the data comment and report templates are rendered against.
+type TemplateData struct {
+	// Repository is the analyzed repository as "owner/name".
+	Repository string
+	// TestSuite is the test suite filter, empty if all test suites were analyzed.
+	TestSuite string
+	// PullRequest is the number of the analyzed pull request, empty for reports on a time frame or commits.
+	PullRequest string
+	// From and To bound the analyzed time frame. Either may be nil.
+	From, To *time.Time
+	// ReportURL links to the full report, e.g. the workflow run it is uploaded by. It may be empty.
+	ReportURL string
+
+	// TotalTestCount is the number of analyzed test reports, FailedTestCount the number of those with failures.
+	TotalTestCount  int
+	FailedTestCount int
+	// FlakeTestCount and SkippedTestCount are the numbers of individual failed and skipped tests.
+	FlakeTestCount   int
+	SkippedTestCount int
+	// Baseline summarizes the classification of the failed tests, empty if the report was not compared with a branch.
+	Baseline string
+	// Owners are the GitHub logins of the owners of the failed tests, sorted, see WithTestOwners.
+	Owners []string
+
+	// FlakeTests are the failed tests, most failures first.
+	FlakeTests []TemplateTest
+	// SkippedTests are the skipped tests, most skips first.
+	SkippedTests []TemplateTest
+}
+
+type TemplateTest struct {
+	ClassName string
+	Name      string
+	// Classification of a failed test against the baseline branch, e.g. "known flake (failed 3× on master in the
+	// last 7 days)". Empty if the report was not compared with a branch.
+	Classification  string
+	Counts          int
+	Commits         []string
+	MeanDurationSec float64
+	Details         []TemplateDetail
+	// Owners are the GitHub logins of the owners of the test, see WithTestOwners.
+	Owners []string
+}
+
+// TemplateDetail is a distinct error of a test and how often it occurred.
+type TemplateDetail struct {
+	Count int
+	Error string
+}
+
+// YAML returns the failed and skipped tests as YAML, in the layout of the detailed template. Names are shown in bold
+// and errors of failed tests start on a new paragraph.
+func (d TemplateData) YAML() (string, error) {
+	report := HtmlFlakeReport{
+		TotalTestCount:   d.TotalTestCount,
+		FailedTestCount:  d.FailedTestCount,
+		FlakeTestCount:   d.FlakeTestCount,
+		SkippedTestCount: d.SkippedTestCount,
+	}
+	for _, test := range d.FlakeTests {
+		entry := htmlTestEntry(test)
+		for i := range entry.Details {
+			entry.Details[i].Error = "\n\n" + entry.Details[i].Error
+		}
+		report.FlakeTests = append(report.FlakeTests, entry)
+	}
+	for _, test := range d.SkippedTests {
+		report.SkippedTests = append(report.SkippedTests, htmlTestEntry(test))
+	}
+	data, err := yaml.Marshal(report)
+	return string(data), err
+}
+
+func htmlTestEntry(test TemplateTest) HtmlTestEntry {
+	entry := HtmlTestEntry{
+		ClassName:       test.ClassName,
+		Name:            "**" + test.Name + "**",
+		Classification:  test.Classification,
+		Counts:          test.Counts,
+		MeanDurationSec: test.MeanDurationSec,
+	}
+	for _, d := range test.Details {
+		entry.Details = append(entry.Details, HtmlTestDetail{Count: d.Count, Error: d.Error})
+	}
+	return entry
+}
+
+const (
+	// TemplateDetailed is the default comment layout: a summary sentence followed by the collapsed YAML report.
+	TemplateDetailed = "detailed"
+	// TemplateCompact renders the failed tests as a table.
+	TemplateCompact = "compact"
+	// TemplateMinimal renders a single sentence naming the failed tests.
+	TemplateMinimal = "minimal"
+)
+
+var builtinTemplates = map[string]string{
+	TemplateDetailed: `{{if .PullRequest}}This PR{{else}}The test suite{{end}} **failed {{.FailedTestCount}} out of ` +
+		`{{.TotalTestCount}} times** with {{.FlakeTestCount}} individual failed tests and {{.SkippedTestCount}} ` +
+		`skipped tests. A test is considered flaky if failed on multiple commits. {{with .Baseline}}
+
+{{.}}{{end}}
+<details>
+
+ {{.YAML}}
+</details>{{with .Owners}}
+
+cc{{range .}} @{{.}}{{end}}{{end}}`,
+
+	TemplateCompact: `{{if .PullRequest}}This PR{{else}}The test suite{{end}} **failed {{.FailedTestCount}} out of ` +
+		`{{.TotalTestCount}} times** with {{.FlakeTestCount}} failed and {{.SkippedTestCount}} skipped tests.` +
+		`{{with .Baseline}} {{.}}{{end}}
+{{if .FlakeTests}}
+| Test | Failures | Commits |{{if .Baseline}} Classification |{{end}}
+|------|----------|---------|{{if .Baseline}}----------------|{{end}}
+{{range .FlakeTests}}| {{escape .Name}} | {{.Counts}} | {{len .Commits}} |{{if $.Baseline}} {{escape .Classification}} |{{end}}
+{{end}}{{end}}{{with .Owners}}
+cc{{range .}} @{{.}}{{end}}{{end}}`,
+
+	TemplateMinimal: `{{if .PullRequest}}This PR{{else}}The test suite{{end}} **failed {{.FailedTestCount}} out of ` +
+		`{{.TotalTestCount}} times** with {{.FlakeTestCount}} failed tests` +
+		`{{range $i, $t := .FlakeTests}}{{if $i}}, {{else}}: {{end}}` + "`{{$t.Name}}`" + `{{end}}.` +
+		`{{with .Owners}} cc{{range .}} @{{.}}{{end}}{{end}}`,
+}
+
+var templateFuncs = template.FuncMap{
+	// escape makes a string fit in a markdown table cell.
+	"escape": escapeTableCell,
+	// truncate shortens a string to at most n bytes.
+	"truncate": func(n int, s string) string { return truncate(s, n) },
+	// short abbreviates a commit SHA.
+	"short": func(sha string) string {
+		if len(sha) > 7 {
+			return sha[:7]
+		}
+		return sha
+	},
+	"join": strings.Join,
+	"trim": strings.TrimSpace,
+}
+
+// LoadTemplate returns the built-in template of the given name, see TemplateDetailed, TemplateCompact and
+// TemplateMinimal, or parses the text/template file at the given path.
+func LoadTemplate(nameOrPath string) (*template.Template, error) {
+	text, ok := builtinTemplates[nameOrPath]
+	name := nameOrPath
+	if !ok {
+		data, err := ioutil.ReadFile(nameOrPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s, %v", nameOrPath, err)
+		}
+		text, name = string(data), filepath.Base(nameOrPath)
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s, %v", nameOrPath, err)
+	}
+	return t, nil
+}
+
+// templateData collects the report for rendering.
+func (f *FlakeReport) templateData() TemplateData {
+	data := TemplateData{
+		Repository:       f.filter.owner + "/" + f.filter.repo,
+		TestSuite:        f.filter.testsuite,
+		PullRequest:      f.filter.pullRequest,
+		From:             f.filter.from,
+		To:               f.filter.to,
+		ReportURL:        f.filter.reportURL,
+		TotalTestCount:   f.TotalTestCount,
+		FailedTestCount:  f.FailedTestCount,
+		FlakeTestCount:   f.FlakeTestCount,
+		SkippedTestCount: f.SkippedTestCount,
+		Baseline:         f.baseline.summary(),
+	}
+	owners := map[string]bool{}
+	for _, test := range f.FlakeTests {
+		t := templateTest(test)
+		t.Classification = f.baseline.label(test)
+		if f.filter.testOwners != nil {
+			t.Owners = f.filter.testOwners(test)
+		}
+		for _, o := range t.Owners {
+			owners[o] = true
+		}
+		data.FlakeTests = append(data.FlakeTests, t)
+	}
+	for o := range owners {
+		data.Owners = append(data.Owners, o)
+	}
+	sort.Strings(data.Owners)
+	for _, test := range f.SkippedTests {
+		data.SkippedTests = append(data.SkippedTests, templateTest(test))
+	}
+	return data
+}
+
+func templateTest(test TestEntry) TemplateTest {
+	t := TemplateTest{
+		ClassName:       test.ClassName,
+		Name:            test.Name,
+		Counts:          test.Counts,
+		Commits:         test.Commits,
+		MeanDurationSec: test.MeanDurationSec,
+	}
+	for _, d := range test.Details {
+		var msg string
+		if d.Error != nil {
+			msg = d.Error.Error()
+		}
+		t.Details = append(t.Details, TemplateDetail{Count: d.Count, Error: msg})
+	}
+	return t
+}
+
+func render(t *template.Template, data TemplateData) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s, %v", t.Name(), err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package reporter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates(t *testing.T) {
+	report := NewFlakeReport()
+	report.filter.pullRequest = "1641"
+	report.TotalTestCount, report.FailedTestCount = 2, 2
+	report.flakeTestMap = testMap{
+		"e2e/flake": {ClassName: "e2e", Name: "flake | retry", Counts: 2, Commits: []string{"a", "b"},
+			Details: []TestDetail{{Count: 2, Error: errors.New("timed out")}}},
+	}
+	_, err := report.GenerateReport("")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "template-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	custom := filepath.Join(dir, "custom.tmpl")
+	require.NoError(t, ioutil.WriteFile(custom, []byte(
+		`{{range .FlakeTests}}{{.Name}}: {{join .Commits ","}}{{end}}`), 0644))
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: TemplateDetailed,
+			expected: "This PR **failed 2 out of 2 times** with 1 individual failed tests and 0 skipped tests. A test" +
+				" is considered flaky if failed on multiple commits. \n<details>\n\n totaltestcount: 2\n"},
+		{template: TemplateCompact,
+			expected: "| Test | Failures | Commits |\n|------|----------|---------|\n| flake \\| retry | 2 | 2 |\n"},
+		{template: TemplateMinimal,
+			expected: "This PR **failed 2 out of 2 times** with 1 failed tests: `flake | retry`."},
+		{template: custom, expected: "flake | retry: a,b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := LoadTemplate(tt.template)
+			require.NoError(t, err)
+			report.filter.commentTemplate = tmpl
+			comment, err := report.generateReportComment()
+			require.NoError(t, err)
+			assert.Contains(t, *comment, tt.expected)
+		})
+	}
+
+	_, err = LoadTemplate(filepath.Join(dir, "missing.tmpl"))
+	assert.Error(t, err)
+}
+
+func TestTemplateOwners(t *testing.T) {
+	report := NewFlakeReport()
+	report.filter.pullRequest = "1641"
+	report.flakeTestMap = testMap{
+		"e2e/flake":   {ClassName: "e2e", Name: "flake", Counts: 2, Commits: []string{"a", "b"}},
+		"e2e/install": {ClassName: "e2e", Name: "install", Counts: 1, Commits: []string{"a"}},
+		"unit/parse":  {ClassName: "unit", Name: "parse", Counts: 1, Commits: []string{"b"}},
+	}
+	report.skippedTestMap = testMap{"e2e/flake": {ClassName: "e2e", Name: "flake", Counts: 1}}
+	removed := report.RemoveTests(func(test TestEntry, failed bool) bool { return test.Name == "flake" })
+	assert.Equal(t, []string{"flake"}, removed)
+	assert.Empty(t, report.skippedTestMap)
+
+	WithTestOwners(func(test TestEntry) []string {
+		if test.ClassName == "e2e" {
+			return []string{"olm", "alice"}
+		}
+		return []string{"olm"}
+	})(&report.filter)
+	_, err := report.GenerateReport("")
+	require.NoError(t, err)
+	tmpl, err := LoadTemplate(TemplateMinimal)
+	require.NoError(t, err)
+	report.filter.commentTemplate = tmpl
+	comment, err := report.generateReportComment()
+	require.NoError(t, err)
+	assert.Contains(t, *comment, " cc @alice @olm")
+	assert.NotContains(t, *comment, "`flake`")
+}
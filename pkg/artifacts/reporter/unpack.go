@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/util/errors"
 )
@@ -14,6 +15,8 @@ import (
 type artifact struct {
 	rawData []byte
 	commit  string
+	// createdAt is the modification time of the zip file, which downloaded artifacts set to their creation time.
+	createdAt time.Time
 }
 
 // LoadZippedArtifactsFromDirectory takes the directory of the artifacts and unwraps the zip files in it.
@@ -39,6 +42,7 @@ func LoadZippedArtifactsFromDirectory(dir string) ([]artifact, error) {
 			errs = append(errs, fmt.Errorf("failed to unwrap %s, %v", f.Name(), err))
 			continue
 		}
+		ar.createdAt = f.ModTime()
 		artifacts = append(artifacts, *ar)
 
 	}
@@ -0,0 +1,170 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"golang.org/x/oauth2"
+)
+
+type appConfig struct {
+	id         int64
+	privateKey []byte
+}
+
+// WithAppAuth authenticates as the installation of a GitHub App on the client's repository instead of using an
+// access token. privateKey is the PEM encoded key generated for the App. Installation tokens are refreshed
+// automatically before they expire.
+func WithAppAuth(appID int64, privateKey []byte) ClientOption {
+	return func(config *clientConfig) {
+		config.app = &appConfig{
+			id:         appID,
+			privateKey: privateKey,
+		}
+	}
+}
+
+// HasCredentials reports whether the options provide credentials that stand in for an access token. Clients fail to
+// be created if a credential provider resolves no token for their repository.
+func HasCredentials(options ...ClientOption) bool {
+	config := &clientConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	return config.app != nil || config.credentials != nil
+}
+
+// appTransport signs every request with a short-lived JWT issued for the App itself. It is only used to look up
+// installations and to mint installation tokens.
+type appTransport struct {
+	id        int64
+	key       *rsa.PrivateKey
+	transport http.RoundTripper
+
+	mu      sync.Mutex
+	jwt     string
+	expires time.Time
+}
+
+func newAppTransport(app *appConfig, transport http.RoundTripper) (*appTransport, error) {
+	key, err := parsePrivateKey(app.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &appTransport{
+		id:        app.id,
+		key:       key,
+		transport: transport,
+	}, nil
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.transport.RoundTrip(req)
+}
+
+func (t *appTransport) token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.jwt != "" && now.Add(time.Minute).Before(t.expires) {
+		return t.jwt, nil
+	}
+
+	// GitHub accepts JWTs valid for at most 10 minutes. The issue time is backdated to allow for clock drift.
+	expires := now.Add(9 * time.Minute)
+	jwt, err := signJWT(t.key, map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": expires.Unix(),
+		"iss": t.id,
+	})
+	if err != nil {
+		return "", err
+	}
+	t.jwt, t.expires = jwt, expires
+	return jwt, nil
+}
+
+// installationTokenSource mints installation access tokens for the App installation on owner/repo.
+type installationTokenSource struct {
+	client         *github.Client
+	owner, repo    string
+	installationID int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	ctx := context.Background()
+	if s.installationID == 0 {
+		installation, _, err := s.client.Apps.FindRepositoryInstallation(ctx, s.owner, s.repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find GitHub App installation for %s/%s, %v", s.owner, s.repo, err)
+		}
+		s.installationID = installation.GetID()
+	}
+
+	token, _, err := s.client.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for %s/%s, %v", s.owner, s.repo, err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt(),
+	}, nil
+}
+
+func signJWT(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key, %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
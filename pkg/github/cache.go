@@ -0,0 +1,169 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CachingTransport is a http.RoundTripper that stores GitHub API responses on disk together with their ETag and
+// Last-Modified validators. Cached requests are sent as conditional requests, and a 304 Not Modified answer is
+// served from the cache. GitHub does not count 304 responses against the rate limit.
+type CachingTransport struct {
+	Dir       string
+	Transport http.RoundTripper
+}
+
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Response     []byte `json:"response"`
+}
+
+// NewCachingTransport returns a CachingTransport storing responses under dir. A nil transport defaults to
+// http.DefaultTransport.
+func NewCachingTransport(dir string, transport http.RoundTripper) *CachingTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &CachingTransport{
+		Dir:       dir,
+		Transport: transport,
+	}
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.Transport.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry, err := t.load(key)
+	if err != nil {
+		logrus.Debugf("Ignoring unreadable cache entry for %s, %v", req.URL, err)
+		entry = nil
+	}
+
+	if entry != nil {
+		// RoundTrippers must not modify the original request.
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		cached, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(entry.Response)), req)
+		if err != nil {
+			return resp, nil
+		}
+		// Keep the rate limit information current.
+		for header, values := range resp.Header {
+			if strings.HasPrefix(header, "X-Ratelimit-") {
+				cached.Header[header] = values
+			}
+		}
+		resp.Body.Close()
+		return cached, nil
+	}
+
+	if resp.StatusCode == http.StatusOK && (resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "") {
+		if err := t.store(key, resp); err != nil {
+			logrus.Debugf("Failed to cache response for %s, %v", req.URL, err)
+		}
+	}
+	return resp, nil
+}
+
+// store dumps the response into the cache and replaces its body so that it can still be consumed by the caller.
+func (t *CachingTransport) store(key string, resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var raw bytes.Buffer
+	stored := *resp
+	stored.Body = ioutil.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	if err := stored.Write(&raw); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Response:     raw.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so that concurrent readers never observe a partial entry.
+	tmp, err := ioutil.TempFile(t.Dir, key+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), t.path(key))
+}
+
+func (t *CachingTransport) load(key string) (*cacheEntry, error) {
+	data, err := ioutil.ReadFile(t.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cache entry %s, %v", key, err)
+	}
+	return entry, nil
+}
+
+func (t *CachingTransport) path(key string) string {
+	return filepath.Join(t.Dir, key+".json")
+}
+
+// cacheKey identifies a request by its URL and its media type. The credentials are left out, as installation tokens
+// rotate hourly: cached responses are only served after GitHub answered the conditional request with 304 Not
+// Modified for the credentials of the request, so they are never served to a token without access.
+func cacheKey(req *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s", req.URL.String(), req.Header.Get("Accept"))
+	return hex.EncodeToString(h.Sum(nil))
+}
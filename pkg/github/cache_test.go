@@ -0,0 +1,79 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingTransportRevalidates(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(100-requests))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"sha":"0b8233d0c2eefb9c3b7402f3709525c7ec6752a7"}]`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "http-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	c, err := NewRepositoryClient(ctx, "token", owner, repo, false, WithHTTPCache(dir))
+	require.NoError(t, err)
+	c.BaseURL, _ = url.Parse(server.URL + "/")
+
+	for i := 0; i < 3; i++ {
+		commits, err := c.ListCommitsFromPR(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0b8233d0c2eefb9c3b7402f3709525c7ec6752a7"}, commits)
+	}
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, notModified)
+}
+
+func TestCachingTransportSurvivesTokenRotation(t *testing.T) {
+	var notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"sha":"0b8233d0c2eefb9c3b7402f3709525c7ec6752a7"}]`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "http-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	for _, token := range []string{"token-1", "token-2"} {
+		c, err := NewRepositoryClient(ctx, token, owner, repo, false, WithHTTPCache(dir))
+		require.NoError(t, err)
+		c.BaseURL, _ = url.Parse(server.URL + "/")
+		commits, err := c.ListCommitsFromPR(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0b8233d0c2eefb9c3b7402f3709525c7ec6752a7"}, commits)
+	}
+	assert.Equal(t, 1, notModified)
+}
@@ -0,0 +1,73 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// maxAnnotationsPerRequest is the number of annotations the Checks API accepts in a single create or update request.
+const maxAnnotationsPerRequest = 50
+
+// CreateCheckRun creates a completed check run on headSHA. Annotations beyond the per-request limit of the Checks API
+// are added with follow-up updates of the check run. Check runs can only be created with GitHub App credentials.
+func (r *RepositoryClient) CreateCheckRun(ctx context.Context, headSHA, name, conclusion, title, summary string,
+	annotations []*github.CheckRunAnnotation) (*github.CheckRun, error) {
+	if r.dryRun != nil {
+		content := fmt.Sprintf("%s: %s (%s)\n\n%s\n", name, title, conclusion, summary)
+		for _, a := range annotations {
+			content += fmt.Sprintf("\n%s:%d: %s", a.GetPath(), a.GetStartLine(), a.GetMessage())
+		}
+		err := r.dryRun.record("check run", fmt.Sprintf("%s/%s@%s", r.Owner, r.Repo, headSHA), content)
+		return &github.CheckRun{Name: github.String(name), HeadSHA: github.String(headSHA),
+			Conclusion: github.String(conclusion)}, err
+	}
+	batch := annotations
+	if len(batch) > maxAnnotationsPerRequest {
+		batch = batch[:maxAnnotationsPerRequest]
+	}
+	run, _, err := r.Checks.CreateCheckRun(ctx, r.Owner, r.Repo, github.CreateCheckRunOptions{
+		Name:        name,
+		HeadSHA:     headSHA,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:       github.String(title),
+			Summary:     github.String(summary),
+			Annotations: batch,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for annotations = annotations[len(batch):]; len(annotations) > 0; annotations = annotations[len(batch):] {
+		batch = annotations
+		if len(batch) > maxAnnotationsPerRequest {
+			batch = batch[:maxAnnotationsPerRequest]
+		}
+		if _, _, err := r.Checks.UpdateCheckRun(ctx, r.Owner, r.Repo, run.GetID(), github.UpdateCheckRunOptions{
+			Name: name,
+			Output: &github.CheckRunOutput{
+				Title:       github.String(title),
+				Summary:     github.String(summary),
+				Annotations: batch,
+			},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// GetPRHeadSHA returns the SHA of the latest commit of a pull request.
+func (r *RepositoryClient) GetPRHeadSHA(ctx context.Context, pullNum int) (string, error) {
+	pr, _, err := r.PullRequests.Get(ctx, r.Owner, r.Repo, pullNum)
+	if err != nil {
+		return "", err
+	}
+	return pr.GetHead().GetSHA(), nil
+}
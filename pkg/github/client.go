@@ -2,6 +2,9 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"sync"
 
 	"github.com/google/go-github/v32/github"
 	"golang.org/x/oauth2"
@@ -12,26 +15,166 @@ type RepositoryClient struct {
 	Owner             string
 	Repo              string
 	WaitForQuotaReset bool
+	// downloadClient downloads artifacts from pre-signed URLs on other hosts, hostDownloadClient from the API host,
+	// authenticated like the API client. Neither caches, so that archives are not written to the HTTP cache.
+	downloadClient     *http.Client
+	hostDownloadClient *http.Client
+	dryRun             *DryRun
+	// appClient is authenticated as the GitHub App itself when authenticating as an App installation.
+	appClient *github.Client
+	identity  *identity
 }
 
-func NewRepositoryClient(ctx context.Context, accessToken, owner, repo string, waitForQuotaReset bool) *RepositoryClient {
-	if accessToken == "" {
-		return &RepositoryClient{
-			Client:            github.NewClient(nil),
-			Owner:             owner,
-			Repo:              repo,
-			WaitForQuotaReset: waitForQuotaReset,
+// identity caches the login a client is authenticated as.
+type identity struct {
+	mu    sync.Mutex
+	login string
+}
+
+type clientConfig struct {
+	cacheDir    string
+	baseURL     string
+	uploadURL   string
+	app         *appConfig
+	credentials CredentialProvider
+	anonymous   bool
+	login       string
+	transport   http.RoundTripper
+	dryRun      *DryRun
+}
+
+// ClientOption configures optional behaviour of a RepositoryClient.
+type ClientOption func(config *clientConfig)
+
+// WithHTTPCache persists GitHub API responses in dir and revalidates them with conditional requests.
+// Responses answered with 304 Not Modified do not count against the rate limit.
+func WithHTTPCache(dir string) ClientOption {
+	return func(config *clientConfig) {
+		config.cacheDir = dir
+	}
+}
+
+// WithEnterpriseURLs targets a GitHub Enterprise Server instance instead of github.com. The upload URL defaults to the
+// base URL when empty.
+func WithEnterpriseURLs(baseURL, uploadURL string) ClientOption {
+	return func(config *clientConfig) {
+		config.baseURL = baseURL
+		config.uploadURL = uploadURL
+	}
+}
+
+// WithTransport sends all requests of the client, including artifact downloads, through transport instead of
+// http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(config *clientConfig) {
+		config.transport = transport
+	}
+}
+
+func NewRepositoryClient(ctx context.Context, accessToken, owner, repo string, waitForQuotaReset bool,
+	options ...ClientOption) (*RepositoryClient, error) {
+	config := &clientConfig{transport: http.DefaultTransport}
+	for _, option := range options {
+		option(config)
+	}
+
+	transport := config.transport
+	if config.cacheDir != "" {
+		transport = NewCachingTransport(config.cacheDir, transport)
+	}
+
+	if accessToken == "" && config.app == nil && config.credentials != nil {
+		var err error
+		if accessToken, err = config.resolveToken(owner, repo); err != nil {
+			return nil, err
 		}
 	}
 
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: accessToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
+	var appClient *github.Client
+	var tokenSource oauth2.TokenSource
+	switch {
+	case config.app != nil:
+		appTransport, err := newAppTransport(config.app, config.transport)
+		if err != nil {
+			return nil, err
+		}
+		if appClient, err = config.newClient(&http.Client{Transport: appTransport}); err != nil {
+			return nil, err
+		}
+		tokenSource = oauth2.ReuseTokenSource(nil, &installationTokenSource{
+			client: appClient,
+			owner:  owner,
+			repo:   repo,
+		})
+	case accessToken != "":
+		tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken})
+	}
+	hostDownloadTransport := config.transport
+	if tokenSource != nil {
+		transport = &oauth2.Transport{Source: tokenSource, Base: transport}
+		hostDownloadTransport = &oauth2.Transport{Source: tokenSource, Base: config.transport}
+	}
+
+	client, err := config.newClient(&http.Client{Transport: transport})
+	if err != nil {
+		return nil, err
+	}
 
 	return &RepositoryClient{
-		Client: github.NewClient(tc),
-		Owner:  owner,
-		Repo:   repo,
+		Client:             client,
+		Owner:              owner,
+		Repo:               repo,
+		WaitForQuotaReset:  waitForQuotaReset,
+		downloadClient:     &http.Client{Transport: config.transport},
+		hostDownloadClient: &http.Client{Transport: hostDownloadTransport},
+		dryRun:             config.dryRun,
+		appClient:          appClient,
+		identity:           &identity{login: config.login},
+	}, nil
+}
+
+// WithLogin tells the client the login it is authenticated as, e.g. as looked up by another client with the same
+// credentials, saving the lookup by Login.
+func WithLogin(login string) ClientOption {
+	return func(config *clientConfig) {
+		config.login = login
+	}
+}
+
+// Login returns the login the client is authenticated as, "<slug>[bot]" for GitHub Apps. It is looked up once.
+func (r *RepositoryClient) Login(ctx context.Context) (string, error) {
+	r.identity.mu.Lock()
+	defer r.identity.mu.Unlock()
+	if r.identity.login != "" {
+		return r.identity.login, nil
+	}
+	if r.appClient != nil {
+		app, _, err := r.appClient.Apps.Get(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to look up the GitHub App, %v", err)
+		}
+		r.identity.login = app.GetSlug() + "[bot]"
+	} else {
+		user, _, err := r.Users.Get(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to look up the authenticated user, %v", err)
+		}
+		r.identity.login = user.GetLogin()
+	}
+	return r.identity.login, nil
+}
+
+func (c *clientConfig) newClient(httpClient *http.Client) (*github.Client, error) {
+	if c.baseURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+	uploadURL := c.uploadURL
+	if uploadURL == "" {
+		uploadURL = c.baseURL
+	}
+	client, err := github.NewEnterpriseClient(c.baseURL, uploadURL, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URL, %v", err)
 	}
+	return client, nil
 }
@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnterpriseArtifactDownload(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/"+owner+"/"+repo+"/actions/artifacts/1/zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/_services/pipelines/artifacts/1.zip")
+		w.WriteHeader(http.StatusFound)
+	})
+	mux.HandleFunc("/_services/pipelines/artifacts/1.zip", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("zip"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "artifacts-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	c, err := NewRepositoryClient(ctx, "token", owner, repo, false, WithEnterpriseURLs(server.URL, ""))
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/api/v3/", c.BaseURL.String())
+
+	downloaded, err := c.DownloadArtifacts(ctx, []*github.Artifact{{ID: github.Int64(1), Name: github.String("e2e")}},
+		dir, "", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e2e"}, downloaded)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "e2e.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, "zip", string(data))
+}
+
+func TestAppInstallationAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	verifyJWT := func(r *http.Request) bool {
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		if len(parts) != 3 {
+			return false
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return false
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	var tokensIssued int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/"+owner+"/"+repo+"/installation", func(w http.ResponseWriter, r *http.Request) {
+		if !verifyJWT(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"id":42}`)
+	})
+	mux.HandleFunc("/api/v3/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if !verifyJWT(r) || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		tokensIssued++
+		fmt.Fprintf(w, `{"token":"installation-token","expires_at":%q}`,
+			time.Now().Add(time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/api/v3/repos/"+owner+"/"+repo+"/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer installation-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `[{"sha":"0b8233d0c2eefb9c3b7402f3709525c7ec6752a7"}]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	c, err := NewRepositoryClient(ctx, "", owner, repo, false, WithEnterpriseURLs(server.URL, ""),
+		WithAppAuth(1, privateKey))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		commits, err := c.ListCommitsFromPR(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0b8233d0c2eefb9c3b7402f3709525c7ec6752a7"}, commits)
+	}
+	assert.Equal(t, 1, tokensIssued)
+}
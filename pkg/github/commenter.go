@@ -2,21 +2,146 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/google/go-github/v32/github"
 )
 
 
 func (r *RepositoryClient) PostPRComment(ctx context.Context, pullNum int, data *string) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("comment", r.target(pullNum), *data)
+	}
 	_, _, err := r.Issues.CreateComment(ctx, r.Owner, r.Repo, pullNum, &github.IssueComment{
 		Body: data,
 	})
 	return err
 }
 
+// CreatePRComment posts a comment on an issue or pull request and returns its ID.
+func (r *RepositoryClient) CreatePRComment(ctx context.Context, pullNum int, data *string) (int64, error) {
+	if r.dryRun != nil {
+		return 0, r.dryRun.record("comment", r.target(pullNum), *data)
+	}
+	comment, _, err := r.Issues.CreateComment(ctx, r.Owner, r.Repo, pullNum, &github.IssueComment{
+		Body: data,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return comment.GetID(), nil
+}
+
+// EditPRComment replaces the body of an existing issue or pull request comment.
+func (r *RepositoryClient) EditPRComment(ctx context.Context, commentID int64, data *string) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("edit comment", fmt.Sprintf("%s/%s comment %d", r.Owner, r.Repo, commentID), *data)
+	}
+	_, _, err := r.Issues.EditComment(ctx, r.Owner, r.Repo, commentID, &github.IssueComment{
+		Body: data,
+	})
+	return err
+}
+
 func (r *RepositoryClient) ListPRComments(ctx context.Context, pullNum int) ([]*github.IssueComment, error) {
-	list, _, err := r.Issues.ListComments(ctx, r.Owner, r.Repo, pullNum, &github.IssueListCommentsOptions{})
-	return list, err
+	done := false
+	page := 0
+	var comments []*github.IssueComment
+	for !done {
+		list, resp, err := r.Issues.ListComments(ctx, r.Owner, r.Repo, pullNum, &github.IssueListCommentsOptions{
+			ListOptions: github.ListOptions{Page: page, PerPage: 100},
+		})
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, list...)
+		if page = resp.NextPage; page == 0 {
+			done = true
+		}
+	}
+	return comments, nil
+}
+
+// MinimizeComment hides a comment behind the given classifier, e.g. "OUTDATED", using the GraphQL API since the REST
+// API offers no equivalent. nodeID is the GraphQL node ID of the comment.
+func (r *RepositoryClient) MinimizeComment(ctx context.Context, nodeID, classifier string) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("minimize comment", fmt.Sprintf("%s/%s comment %s", r.Owner, r.Repo, nodeID),
+			classifier)
+	}
+	body := map[string]interface{}{
+		"query": `mutation($id: ID!, $classifier: ReportedContentClassifiers!) {
+  minimizeComment(input: {subjectId: $id, classifier: $classifier}) { minimizedComment { isMinimized } }
+}`,
+		"variables": map[string]string{"id": nodeID, "classifier": classifier},
+	}
+	req, err := r.NewRequest("POST", r.graphQLURL(), body)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := r.Do(ctx, req, &result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("failed to minimize comment %s, %s", nodeID, result.Errors[0].Message)
+	}
+	return nil
+}
+
+// MinimizedComments returns which of the comments with the given GraphQL node IDs are minimized, in one query.
+func (r *RepositoryClient) MinimizedComments(ctx context.Context, nodeIDs []string) (map[string]bool, error) {
+	minimized := map[string]bool{}
+	if len(nodeIDs) == 0 {
+		return minimized, nil
+	}
+	body := map[string]interface{}{
+		"query": `query($ids: [ID!]!) {
+  nodes(ids: $ids) { ... on IssueComment { id isMinimized } }
+}`,
+		"variables": map[string]interface{}{"ids": nodeIDs},
+	}
+	req, err := r.NewRequest("POST", r.graphQLURL(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data struct {
+			Nodes []struct {
+				ID          string `json:"id"`
+				IsMinimized bool   `json:"isMinimized"`
+			} `json:"nodes"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := r.Do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("failed to look up minimized comments, %s", result.Errors[0].Message)
+	}
+	for _, node := range result.Data.Nodes {
+		minimized[node.ID] = node.IsMinimized
+	}
+	return minimized, nil
+}
+
+// graphQLURL returns the GraphQL endpoint, which GitHub Enterprise Server serves at /api/graphql next to the
+// /api/v3/ REST API.
+func (r *RepositoryClient) graphQLURL() string {
+	u := *r.BaseURL
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.Path = strings.TrimSuffix(u.Path, "/v3") + "/graphql"
+	return u.String()
 }
 
 func (r *RepositoryClient) ListCommitsFromPR(ctx context.Context, pullNum int) ([]string, error) {
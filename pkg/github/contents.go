@@ -0,0 +1,85 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// GetFile returns the content and blob SHA of the file at path on ref, e.g. a branch name. An empty ref reads the
+// default branch. A nil content and no error are returned if the file or ref do not exist.
+func (r *RepositoryClient) GetFile(ctx context.Context, path, ref string) ([]byte, string, error) {
+	file, _, resp, err := r.Repositories.GetContents(ctx, r.Owner, r.Repo, path,
+		&github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	if file == nil {
+		return nil, "", fmt.Errorf("%s is a directory", path)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(content), file.GetSHA(), nil
+}
+
+// PutFile commits content as the file at path on branch and returns the new blob SHA. sha must be the blob SHA of
+// the file being replaced, or empty if the file is created. GitHub rejects the commit with 409 Conflict if the file
+// changed in the meantime.
+func (r *RepositoryClient) PutFile(ctx context.Context, path, branch, sha, message string, content []byte) (string,
+	error) {
+	if r.dryRun != nil {
+		return sha, r.dryRun.record("commit", fmt.Sprintf("%s/%s %s:%s", r.Owner, r.Repo, branch, path),
+			message+"\n\n"+string(content))
+	}
+	opts := &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Content: content,
+		Branch:  github.String(branch),
+	}
+	if sha != "" {
+		opts.SHA = github.String(sha)
+	}
+	result, _, err := r.Repositories.CreateFile(ctx, r.Owner, r.Repo, path, opts)
+	if err != nil {
+		return "", err
+	}
+	return result.GetContent().GetSHA(), nil
+}
+
+// EnsureBranch creates branch from the head of the default branch if it does not exist yet.
+func (r *RepositoryClient) EnsureBranch(ctx context.Context, branch string) error {
+	if r.dryRun != nil {
+		return nil
+	}
+	_, resp, err := r.Git.GetRef(ctx, r.Owner, r.Repo, "heads/"+branch)
+	if err == nil {
+		return nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	repo, _, err := r.Repositories.Get(ctx, r.Owner, r.Repo)
+	if err != nil {
+		return err
+	}
+	head, _, err := r.Git.GetRef(ctx, r.Owner, r.Repo, "heads/"+repo.GetDefaultBranch())
+	if err != nil {
+		return fmt.Errorf("failed to look up the default branch %s, %v", repo.GetDefaultBranch(), err)
+	}
+	_, _, err = r.Git.CreateRef(ctx, r.Owner, r.Repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: head.GetObject().SHA},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create branch %s, %v", branch, err)
+	}
+	return nil
+}
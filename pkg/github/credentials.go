@@ -0,0 +1,231 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CredentialProvider looks up the access token for a repository on a GitHub host. Providers return an empty token
+// without error when they hold no credentials for the repository.
+type CredentialProvider interface {
+	Token(host, owner, repo string) (string, error)
+}
+
+// CredentialChain asks each provider in order and returns the first token found.
+type CredentialChain []CredentialProvider
+
+func (c CredentialChain) Token(host, owner, repo string) (string, error) {
+	for _, provider := range c {
+		token, err := provider.Token(host, owner, repo)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			return token, nil
+		}
+	}
+	return "", nil
+}
+
+// NewCredentialChain returns the default chain: environment variables, token files under tokenDir, the netrc file
+// and the git credential helper, in that order. Empty arguments skip the corresponding provider.
+func NewCredentialChain(tokenDir, netrcFile, helper string) CredentialChain {
+	chain := CredentialChain{EnvCredentials{}}
+	if tokenDir != "" {
+		chain = append(chain, TokenDirCredentials{Dir: tokenDir})
+	}
+	if netrcFile != "" {
+		chain = append(chain, NetrcCredentials{Path: netrcFile})
+	}
+	if helper != "" {
+		chain = append(chain, HelperCredentials{Command: helper})
+	}
+	return chain
+}
+
+// WithCredentials resolves the access token of the client's repository through provider when no token is given.
+func WithCredentials(provider CredentialProvider) ClientOption {
+	return func(config *clientConfig) {
+		config.credentials = provider
+	}
+}
+
+// WithAnonymousFallback lets clients whose credential provider finds no token call the API unauthenticated instead of
+// failing, e.g. to read public repositories. Unauthenticated requests have a much lower rate limit, and writes fail.
+func WithAnonymousFallback() ClientOption {
+	return func(config *clientConfig) {
+		config.anonymous = true
+	}
+}
+
+var envNameReplacer = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// EnvCredentials reads GITHUB_TOKEN_<OWNER>_<REPO>, GITHUB_TOKEN_<OWNER> and GITHUB_TOKEN, in that order. Owner and
+// repository are upper-cased and every other character than letters and digits is replaced by an underscore.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Token(host, owner, repo string) (string, error) {
+	ownerName := envNameReplacer.ReplaceAllString(strings.ToUpper(owner), "_")
+	repoName := envNameReplacer.ReplaceAllString(strings.ToUpper(repo), "_")
+	for _, name := range []string{
+		"GITHUB_TOKEN_" + ownerName + "_" + repoName,
+		"GITHUB_TOKEN_" + ownerName,
+		"GITHUB_TOKEN",
+	} {
+		if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+			return token, nil
+		}
+	}
+	return "", nil
+}
+
+// TokenDirCredentials reads tokens from the files <Dir>/<owner>/<repo>, <Dir>/<owner>/default and <Dir>/default, in
+// that order.
+type TokenDirCredentials struct {
+	Dir string
+}
+
+func (c TokenDirCredentials) Token(host, owner, repo string) (string, error) {
+	for _, file := range []string{
+		filepath.Join(c.Dir, owner, repo),
+		filepath.Join(c.Dir, owner, "default"),
+		filepath.Join(c.Dir, "default"),
+	} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fmt.Errorf("failed to read token file %s, %v", file, err)
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+	return "", nil
+}
+
+// NetrcCredentials reads the password of the `machine` entry matching the GitHub host. An entry whose `login` is the
+// repository owner takes precedence over other entries of the same host.
+type NetrcCredentials struct {
+	Path string
+}
+
+func (c NetrcCredentials) Token(host, owner, repo string) (string, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read netrc file %s, %v", c.Path, err)
+	}
+
+	type machine struct {
+		host, login, password string
+	}
+	var machines []*machine
+	var current *machine
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 < len(fields) {
+				i++
+				current = &machine{host: fields[i]}
+				machines = append(machines, current)
+			}
+		case "default":
+			current = &machine{}
+			machines = append(machines, current)
+		case "login", "password":
+			if current != nil && i+1 < len(fields) {
+				if fields[i] == "login" {
+					current.login = fields[i+1]
+				} else {
+					current.password = fields[i+1]
+				}
+				i++
+			}
+		}
+	}
+
+	var token string
+	for _, m := range machines {
+		// Entries without a machine name come from `default` and apply to every host.
+		if m.host != "" && m.host != host && m.host != "api."+host {
+			continue
+		}
+		if strings.EqualFold(m.login, owner) {
+			return m.password, nil
+		}
+		if token == "" {
+			token = m.password
+		}
+	}
+	return token, nil
+}
+
+// HelperCredentials runs a git credential helper, e.g. `gh auth git-credential`, with the `get` action and returns
+// the password it reports for https://<host>/<owner>/<repo>.
+type HelperCredentials struct {
+	Command string
+}
+
+func (c HelperCredentials) Token(host, owner, repo string) (string, error) {
+	args := strings.Fields(c.Command)
+	if len(args) == 0 {
+		return "", nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], append(args[1:], "get")...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\npath=%s/%s\n\n", host, owner, repo))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("credential helper %q failed, %v: %s", c.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if password := strings.TrimPrefix(scanner.Text(), "password="); password != scanner.Text() {
+			return strings.TrimSpace(password), nil
+		}
+	}
+	return "", nil
+}
+
+func (c *clientConfig) resolveToken(owner, repo string) (string, error) {
+	host := "github.com"
+	if c.baseURL != "" {
+		u, err := url.Parse(c.baseURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid GitHub Enterprise URL, %v", err)
+		}
+		host = u.Hostname()
+	}
+
+	token, err := c.credentials.Token(host, owner, repo)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		if c.anonymous {
+			logrus.Warnf("No token or credentials found for %s/%s on %s, calling the API unauthenticated", owner, repo,
+				host)
+			return "", nil
+		}
+		return "", fmt.Errorf("no token or credentials found for %s/%s on %s", owner, repo, host)
+	}
+	return token, nil
+}
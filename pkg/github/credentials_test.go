@@ -0,0 +1,87 @@
+package github
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenDir := filepath.Join(dir, "tokens")
+	require.NoError(t, os.MkdirAll(filepath.Join(tokenDir, owner), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tokenDir, owner, repo), []byte("file-repo-token\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tokenDir, owner, "default"), []byte("file-owner-token"), 0600))
+
+	netrc := filepath.Join(dir, "netrc")
+	require.NoError(t, ioutil.WriteFile(netrc, []byte(`machine github.com login someone password netrc-token
+machine api.github.com
+  login kubernetes
+  password netrc-kubernetes-token
+`), 0600))
+
+	helper := filepath.Join(dir, "helper")
+	require.NoError(t, ioutil.WriteFile(helper, []byte(`#!/bin/sh
+test "$1" = get || exit 1
+grep -q "path=acme/" && echo "password=helper-token"
+exit 0
+`), 0700))
+
+	for _, name := range []string{"GITHUB_TOKEN", "GITHUB_TOKEN_OPERATOR_FRAMEWORK",
+		"GITHUB_TOKEN_OPERATOR_FRAMEWORK_OPERATOR_LIFECYCLE_MANAGER"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	chain := NewCredentialChain(tokenDir, netrc, helper)
+	tests := []struct {
+		name        string
+		host, owner string
+		repo        string
+		env         map[string]string
+		token       string
+	}{
+		{name: "repo token file", host: "github.com", owner: owner, repo: repo, token: "file-repo-token"},
+		{name: "owner token file", host: "github.com", owner: owner, repo: "api", token: "file-owner-token"},
+		{name: "repo environment variable", host: "github.com", owner: owner, repo: repo, token: "env-repo-token",
+			env: map[string]string{"GITHUB_TOKEN_OPERATOR_FRAMEWORK_OPERATOR_LIFECYCLE_MANAGER": "env-repo-token",
+				"GITHUB_TOKEN": "env-token"}},
+		{name: "netrc login matching owner", host: "github.com", owner: "kubernetes", repo: "kubernetes",
+			token: "netrc-kubernetes-token"},
+		{name: "netrc host", host: "github.com", owner: "acme", repo: "widgets", token: "netrc-token"},
+		{name: "credential helper", host: "github.example.com", owner: "acme", repo: "widgets", token: "helper-token"},
+		{name: "no credentials", host: "github.example.com", owner: "other", repo: "widgets", token: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			token, err := chain.Token(tt.host, tt.owner, tt.repo)
+			require.NoError(t, err)
+			assert.Equal(t, tt.token, token)
+		})
+	}
+}
+
+func TestNewRepositoryClientWithoutCredentials(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewRepositoryClient(ctx, "", owner, repo, false, WithCredentials(CredentialChain{}))
+	require.EqualError(t, err, "no token or credentials found for "+owner+"/"+repo+" on github.com")
+
+	_, err = NewRepositoryClient(ctx, "token", owner, repo, false, WithCredentials(CredentialChain{}))
+	require.NoError(t, err)
+
+	_, err = NewRepositoryClient(ctx, "", owner, repo, false, WithCredentials(CredentialChain{}),
+		WithAnonymousFallback())
+	require.NoError(t, err)
+}
@@ -34,6 +34,28 @@ func (r *RepositoryClient) ListAllArtifacts(ctx context.Context) ([]*github.Arti
 	return artifactList, nil
 }
 
+// ListNewArtifacts lists the artifacts created after the artifact with ID since, newest first. GitHub lists artifacts
+// newest first, so paging stops at the first known artifact.
+func (r *RepositoryClient) ListNewArtifacts(ctx context.Context, since int64) ([]*github.Artifact, error) {
+	var artifactList []*github.Artifact
+	page := 0
+	for {
+		list, resp, err := r.Actions.ListArtifacts(ctx, r.Owner, r.Repo, &github.ListOptions{Page: page, PerPage: 100})
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range list.Artifacts {
+			if a.GetID() <= since {
+				return artifactList, nil
+			}
+			artifactList = append(artifactList, a)
+		}
+		if page = resp.NextPage; page == 0 {
+			return artifactList, nil
+		}
+	}
+}
+
 // DownloadArtifacts tries to download artifacts from a artifact list to a directory based on name and time filtering.
 // The client is required to have authentication.
 // The function returns a list of successfully downloaded artifacts and error.
@@ -75,7 +97,7 @@ func (r *RepositoryClient) DownloadArtifacts(ctx context.Context, artifactList [
 			}
 		}
 
-		err := r.downloadArtifact(ctx, l.GetID(), l.GetName(), dir)
+		err := r.downloadArtifact(ctx, l.GetID(), l.GetName(), dir, l.GetCreatedAt().Time)
 		if err != nil {
 			errs = append(errs, err)
 		} else {
@@ -86,7 +108,10 @@ func (r *RepositoryClient) DownloadArtifacts(ctx context.Context, artifactList [
 	return artifacts, utilerrors.NewAggregate(errs)
 }
 
-func (r *RepositoryClient) downloadArtifact(ctx context.Context, artifactID int64, name, dir string) error {
+// downloadArtifact saves the artifact as <dir>/<name>.zip. The modification time of the file is set to the creation
+// time of the artifact, which tells when the tests ran.
+func (r *RepositoryClient) downloadArtifact(ctx context.Context, artifactID int64, name, dir string,
+	createdAt time.Time) error {
 	url, res, err := r.Actions.DownloadArtifact(ctx, r.Owner, r.Repo, artifactID, false)
 	if err != nil {
 		return err
@@ -96,20 +121,38 @@ func (r *RepositoryClient) downloadArtifact(ctx context.Context, artifactID int6
 		waitForQuota(res)
 	}
 
-	resp, err := http.Get(url.String())
+	// GitHub Enterprise Server may redirect to a relative location on its own host, which requires the credentials
+	// of the API client. Other hosts serve pre-signed URLs and must not receive the token. Archives are never cached.
+	url = r.BaseURL.ResolveReference(url)
+	client := r.downloadClient
+	if url.Host == r.BaseURL.Host {
+		client = r.hostDownloadClient
+	}
+
+	resp, err := client.Get(url.String())
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download artifact %s, %s", name, resp.Status)
+	}
 
-	out, err := os.Create(fmt.Sprintf("%s/%s.zip", path.Clean(dir), name))
+	file := fmt.Sprintf("%s/%s.zip", path.Clean(dir), name)
+	out, err := os.Create(file)
 	if err != nil {
 		return fmt.Errorf("failed to create zip file at %s, %v", dir, err)
 	}
-	defer out.Close()
 
 	// Write the body to file
 	_, err = io.Copy(out, resp.Body)
-	return err
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || createdAt.IsZero() {
+		return err
+	}
+	return os.Chtimes(file, createdAt, createdAt)
 }
 
 func waitForQuota(response *github.Response) {
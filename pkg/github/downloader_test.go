@@ -2,9 +2,20 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/flak-analyzer/pkg/github/recorder"
 )
 
 const (
@@ -15,12 +26,63 @@ const (
 func TestListAllArtifacts(t *testing.T) {
 	ctx := context.Background()
 
-	c := NewRepositoryClient(ctx,"", owner, repo,true)
+	rec, err := recorder.New("testData/fixtures/list-all-artifacts.yaml", recorder.ModeFromEnv(), nil)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, rec.Stop()) }()
+
+	c, err := NewRepositoryClient(ctx, recorder.Token(recorder.ModeFromEnv()), owner, repo, true, WithTransport(rec))
+	assert.NoError(t, err)
 	list, err := c.ListAllArtifacts(ctx)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, list)
 
-	l,err:=c.ListCommitsFromPR(ctx,1641)
+	l, err := c.ListCommitsFromPR(ctx, 1641)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, l)
 }
+
+func TestDownloadArtifactUncached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/" + owner + "/" + repo + "/actions/artifacts/1/zip":
+			// GitHub Enterprise Server redirects to its own host.
+			http.Redirect(w, r, "/download/1", http.StatusFound)
+		case "/download/1":
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("ETag", `"zip"`)
+			fmt.Fprint(w, "artifact archive")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "http-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	dir, err := ioutil.TempDir("", "artifacts-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	c, err := NewRepositoryClient(ctx, "token", owner, repo, false, WithHTTPCache(cacheDir))
+	require.NoError(t, err)
+	c.BaseURL, _ = url.Parse(server.URL + "/")
+	require.NoError(t, c.downloadArtifact(ctx, 1, "e2e", dir, time.Time{}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "e2e.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, "artifact archive", string(data))
+	// The archive is downloaded with the credentials of the client, but not written to its HTTP cache.
+	var cached []string
+	require.NoError(t, filepath.Walk(cacheDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			cached = append(cached, path)
+		}
+		return err
+	}))
+	assert.Empty(t, cached)
+}
@@ -0,0 +1,72 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DryRun collects the changes clients would make to GitHub instead of making them, see WithDryRun.
+type DryRun struct {
+	out io.Writer
+	dir string
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewDryRun writes the changes that would be made to out, or as one file per change in dir if it is not empty.
+func NewDryRun(out io.Writer, dir string) *DryRun {
+	return &DryRun{out: out, dir: dir}
+}
+
+// WithDryRun makes no changes to GitHub: comments, labels, reruns, check runs, issues and files are written to dryRun
+// instead. Reads are made as usual.
+func WithDryRun(dryRun *DryRun) ClientOption {
+	return func(config *clientConfig) {
+		config.dryRun = dryRun
+	}
+}
+
+// IsDryRun tells whether options make no changes to GitHub, see WithDryRun.
+func IsDryRun(options ...ClientOption) bool {
+	config := &clientConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	return config.dryRun != nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._]+`)
+
+// SafeFileName turns name, e.g. owner/repo#1, into a file name by replacing the characters other than letters, digits,
+// dots and underscores with dashes.
+func SafeFileName(name string) string {
+	return strings.Trim(unsafeFileChars.ReplaceAllString(name, "-"), "-")
+}
+
+// record writes a change to target, e.g. owner/repo#1, that would be made.
+func (d *DryRun) record(action, target, content string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n++
+	if d.dir == "" {
+		_, err := fmt.Fprintf(d.out, "--- dry run: %s %s ---\n%s\n", action, target, strings.TrimSuffix(content, "\n"))
+		return err
+	}
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%03d-%s-%s.md", d.n, unsafeFileChars.ReplaceAllString(action, "-"), SafeFileName(target))
+	return ioutil.WriteFile(filepath.Join(d.dir, name), []byte(content), 0644)
+}
+
+// target names an issue or pull request of the repository of r.
+func (r *RepositoryClient) target(number int) string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, number)
+}
@@ -0,0 +1,1364 @@
+// Package fake provides an in-process GitHub API server for end-to-end tests. It serves artifacts, signed artifact
+// downloads, workflow runs, pull requests, commits and comments from in-memory state, and can simulate rate limiting
+// and errors.
+package fake
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// Login is the user the fake server authenticates every token as.
+const Login = "flake-bot"
+
+type Artifact struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+	Expired   bool
+	Data      []byte
+}
+
+type WorkflowRun struct {
+	ID         int64
+	HeadSHA    string
+	HeadBranch string
+	Status     string
+	Conclusion string
+	CreatedAt  time.Time
+	// UpdatedAt is when the run completed, CreatedAt if zero.
+	UpdatedAt time.Time
+	// Attempts counts the re-runs requested for the run.
+	Attempts int
+}
+
+type PullRequest struct {
+	Number  int
+	State   string
+	Merged  bool
+	Draft   bool
+	Labels  []string
+	Commits []string
+}
+
+type Comment struct {
+	ID        int64
+	Body      string
+	User      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// MinimizedReason is the classifier the comment was minimized with through the GraphQL API, if any.
+	MinimizedReason string
+}
+
+type Issue struct {
+	Number int
+	Title  string
+	Body   string
+	State  string
+	Labels []string
+}
+
+type CheckRun struct {
+	ID          int64
+	Name        string
+	HeadSHA     string
+	Status      string
+	Conclusion  string
+	Title       string
+	Summary     string
+	Annotations []*github.CheckRunAnnotation
+}
+
+// Branch is a git branch, reduced to the content of its files and the SHA of its head commit.
+type Branch struct {
+	Head  string
+	Files map[string][]byte
+}
+
+// Repository holds the state of a single repository. Requests are served concurrently, so once the server started its
+// fields, and those of the values returned by the Server helpers, are only read or modified through Server.Update; the
+// other Server helpers are safe to use at any time.
+type Repository struct {
+	Owner        string
+	Name         string
+	Artifacts    []*Artifact
+	WorkflowRuns []*WorkflowRun
+	PullRequests []*PullRequest
+	Comments     map[int][]*Comment
+	CheckRuns    []*CheckRun
+	Issues       []*Issue
+	// DefaultBranch names the branch of Branches served as the default one, "master" unless changed.
+	DefaultBranch string
+	Branches      map[string]*Branch
+	// Collaborators maps users to their permission, "admin", "write" or "read". Other users have read permission.
+	Collaborators map[string]string
+}
+
+type injectedError struct {
+	method  string
+	path    *regexp.Regexp
+	status  int
+	message string
+	times   int
+}
+
+// Server is a fake GitHub API. API requests are accepted under both "/" and "/api/v3/", so clients can use either
+// the server URL or WithEnterpriseURLs(server.URL, "").
+type Server struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	repos          map[string]*Repository
+	nextID         int64
+	rateLimit      int
+	rateRemaining  int
+	rateReset      time.Time
+	errors         []*injectedError
+	requests       []string
+	tokens         []string
+	downloadSecret string
+	gists          map[string]map[string]string
+}
+
+// NewServer starts a fake GitHub API server. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		repos:          map[string]*Repository{},
+		gists:          map[string]map[string]string{},
+		nextID:         1000,
+		rateLimit:      5000,
+		rateRemaining:  5000,
+		rateReset:      time.Now().Add(time.Hour),
+		downloadSecret: strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Repo returns the repository owner/name, creating it if necessary.
+func (s *Server) Repo(owner, name string) *Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repo(owner, name)
+}
+
+// Update calls update with the repository owner/name, creating it if necessary, while no request is served. update
+// may read or modify the repository and the values returned by the other Server helpers.
+func (s *Server) Update(owner, name string, update func(r *Repository)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.repo(owner, name))
+}
+
+func (s *Server) repo(owner, name string) *Repository {
+	key := strings.ToLower(owner + "/" + name)
+	r, ok := s.repos[key]
+	if !ok {
+		r = &Repository{
+			Owner:         owner,
+			Name:          name,
+			Comments:      map[int][]*Comment{},
+			DefaultBranch: "master",
+			Branches:      map[string]*Branch{"master": {Head: s.commitSHA(), Files: map[string][]byte{}}},
+			Collaborators: map[string]string{},
+		}
+		s.repos[key] = r
+	}
+	return r
+}
+
+func (s *Server) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// AddArtifact stores an artifact with the zip content data and returns its ID.
+func (s *Server) AddArtifact(owner, repo, name string, createdAt time.Time, data []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := &Artifact{
+		ID:        s.id(),
+		Name:      name,
+		CreatedAt: createdAt,
+		Data:      data,
+	}
+	r := s.repo(owner, repo)
+	r.Artifacts = append(r.Artifacts, a)
+	return a.ID
+}
+
+// AddWorkflowRun stores a completed workflow run with the given conclusion. The returned run may be modified through
+// Update, e.g. to set its branch.
+func (s *Server) AddWorkflowRun(owner, repo string, id int64, headSHA, conclusion string) *WorkflowRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(owner, repo)
+	run := &WorkflowRun{
+		ID:         id,
+		HeadSHA:    headSHA,
+		Status:     "completed",
+		Conclusion: conclusion,
+		CreatedAt:  time.Now(),
+	}
+	r.WorkflowRuns = append(r.WorkflowRuns, run)
+	return run
+}
+
+// AddPullRequest stores an open pull request with the given commits, the last one being the head.
+func (s *Server) AddPullRequest(owner, repo string, number int, commits ...string) *PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := &PullRequest{
+		Number:  number,
+		State:   "open",
+		Commits: commits,
+	}
+	r := s.repo(owner, repo)
+	r.PullRequests = append(r.PullRequests, pr)
+	return pr
+}
+
+// AddComment posts a comment by user on an issue or pull request and returns its ID.
+func (s *Server) AddComment(owner, repo string, number int, user, body string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	c := &Comment{
+		ID:        s.id(),
+		Body:      body,
+		User:      user,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r := s.repo(owner, repo)
+	r.Comments[number] = append(r.Comments[number], c)
+	return c.ID
+}
+
+// Comments returns a copy of the comments on an issue or pull request.
+func (s *Server) Comments(owner, repo string, number int) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var comments []Comment
+	for _, c := range s.repo(owner, repo).Comments[number] {
+		comments = append(comments, *c)
+	}
+	return comments
+}
+
+// AddFile commits content as the file at path on branch, creating the branch if necessary.
+func (s *Server) AddFile(owner, repo, branch, path string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(owner, repo)
+	b, ok := r.Branches[branch]
+	if !ok {
+		b = &Branch{Files: map[string][]byte{}}
+		r.Branches[branch] = b
+	}
+	b.Files[path] = content
+	b.Head = s.commitSHA()
+}
+
+// File returns the content of the file at path on branch, or nil if there is no such file.
+func (s *Server) File(owner, repo, branch, path string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.repo(owner, repo).Branches[branch]
+	if !ok {
+		return nil
+	}
+	return b.Files[path]
+}
+
+// AddGist stores a gist with the given files, by name.
+func (s *Server) AddGist(id string, files map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gists[id] = files
+}
+
+// GistFile returns the content of a file of a gist, or false if there is no such file.
+func (s *Server) GistFile(id, name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.gists[id][name]
+	return content, ok
+}
+
+// SetRateLimit sets the remaining quota. Requests are rejected with a rate limit error once it reaches zero.
+func (s *Server) SetRateLimit(remaining int, reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateRemaining = remaining
+	s.rateReset = reset
+}
+
+// FailRequests makes the next times requests matching method and the path expression, e.g.
+// `/repos/o/r/actions/runs/\d+`, fail with status. A negative times fails them indefinitely.
+func (s *Server) FailRequests(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, &injectedError{
+		method:  method,
+		path:    regexp.MustCompile("^" + path + "$"),
+		status:  status,
+		message: http.StatusText(status),
+		times:   times,
+	})
+}
+
+// Requests returns the "METHOD /path" of every API request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Tokens returns the token every API request served so far was authenticated with, in the order of Requests.
+func (s *Server) Tokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+type route struct {
+	method  string
+	path    *regexp.Regexp
+	handler func(s *Server, w http.ResponseWriter, r *http.Request, repo *Repository, args []string)
+}
+
+var repoPath = `/repos/([^/]+)/([^/]+)`
+
+var routes = []route{
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `$`), (*Server).getRepository},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/contents/(.+)$`), (*Server).getContents},
+	{http.MethodPut, regexp.MustCompile(`^` + repoPath + `/contents/(.+)$`), (*Server).putContents},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/git/ref/heads/(.+)$`), (*Server).getBranchRef},
+	{http.MethodPost, regexp.MustCompile(`^` + repoPath + `/git/refs$`), (*Server).createRef},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/actions/artifacts$`), (*Server).listArtifacts},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/actions/artifacts/(\d+)/zip$`), (*Server).downloadArtifact},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/actions/runs$`), (*Server).listWorkflowRuns},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/actions/runs/(\d+)$`), (*Server).getWorkflowRun},
+	{http.MethodPost, regexp.MustCompile(`^` + repoPath + `/actions/runs/(\d+)/rerun-failed-jobs$`),
+		(*Server).rerunFailedJobs},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/pulls$`), (*Server).listPullRequests},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/pulls/(\d+)$`), (*Server).getPullRequest},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/pulls/(\d+)/commits$`), (*Server).listCommits},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/issues/(\d+)/comments$`), (*Server).listComments},
+	{http.MethodPost, regexp.MustCompile(`^` + repoPath + `/issues/(\d+)/comments$`), (*Server).createComment},
+	{http.MethodPatch, regexp.MustCompile(`^` + repoPath + `/issues/comments/(\d+)$`), (*Server).editComment},
+	{http.MethodDelete, regexp.MustCompile(`^` + repoPath + `/issues/comments/(\d+)$`), (*Server).deleteComment},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/issues$`), (*Server).listIssues},
+	{http.MethodPost, regexp.MustCompile(`^` + repoPath + `/issues$`), (*Server).createIssue},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/issues/(\d+)$`), (*Server).getIssue},
+	{http.MethodPatch, regexp.MustCompile(`^` + repoPath + `/issues/(\d+)$`), (*Server).editIssue},
+	{http.MethodPost, regexp.MustCompile(`^` + repoPath + `/issues/(\d+)/labels$`), (*Server).addLabels},
+	{http.MethodDelete, regexp.MustCompile(`^` + repoPath + `/issues/(\d+)/labels/([^/]+)$`), (*Server).removeLabel},
+	{http.MethodGet, regexp.MustCompile(`^` + repoPath + `/collaborators/([^/]+)/permission$`),
+		(*Server).getPermission},
+	{http.MethodPost, regexp.MustCompile(`^` + repoPath + `/check-runs$`), (*Server).createCheckRun},
+	{http.MethodPatch, regexp.MustCompile(`^` + repoPath + `/check-runs/(\d+)$`), (*Server).updateCheckRun},
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v3")
+
+	if strings.HasPrefix(path, "/_artifacts/") {
+		s.serveArtifactDownload(w, r, path)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+path)
+	auth := strings.Fields(r.Header.Get("Authorization"))
+	if len(auth) == 2 {
+		s.tokens = append(s.tokens, auth[1])
+	} else {
+		s.tokens = append(s.tokens, "")
+	}
+
+	if s.rateRemaining <= 0 {
+		s.writeRateHeaders(w)
+		writeError(w, http.StatusForbidden, "API rate limit exceeded for "+Login+".")
+		return
+	}
+	s.rateRemaining--
+	s.writeRateHeaders(w)
+
+	for _, e := range s.errors {
+		if e.times != 0 && (e.method == "" || e.method == r.Method) && e.path.MatchString(path) {
+			e.times--
+			writeError(w, e.status, e.message)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost && (path == "/graphql" || path == "/api/graphql") {
+		s.graphQL(w, r)
+		return
+	}
+
+	if strings.HasPrefix(path, "/gists/") {
+		s.serveGist(w, r, strings.TrimPrefix(path, "/gists/"))
+		return
+	}
+
+	if r.Method == http.MethodGet && path == "/user" {
+		writeJSON(w, http.StatusOK, &github.User{Login: github.String(Login)})
+		return
+	}
+
+	for _, route := range routes {
+		if route.method != r.Method {
+			continue
+		}
+		args := route.path.FindStringSubmatch(path)
+		if args == nil {
+			continue
+		}
+		route.handler(s, w, r, s.repo(args[1], args[2]), args[3:])
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) writeRateHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.rateRemaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(s.rateReset.Unix(), 10))
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// paginate slices items according to the page and per_page query parameters and sets the Link header.
+func paginate(w http.ResponseWriter, r *http.Request, length int) (int, int) {
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage <= 0 {
+		perPage = 30
+	}
+	if perPage > 100 {
+		perPage = 100
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	start, end := (page-1)*perPage, page*perPage
+	if start > length {
+		start = length
+	}
+	if end > length {
+		end = length
+	}
+	if end < length {
+		next := *r.URL
+		q := next.Query()
+		q.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.RequestURI()))
+	}
+	return start, end
+}
+
+func (s *Server) listArtifacts(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	start, end := paginate(w, r, len(repo.Artifacts))
+	list := &github.ArtifactList{
+		TotalCount: github.Int64(int64(len(repo.Artifacts))),
+		Artifacts:  []*github.Artifact{},
+	}
+	// GitHub lists the newest artifacts first.
+	for i := len(repo.Artifacts) - 1 - start; i > len(repo.Artifacts)-1-end; i-- {
+		a := repo.Artifacts[i]
+		list.Artifacts = append(list.Artifacts, &github.Artifact{
+			ID:          github.Int64(a.ID),
+			Name:        github.String(a.Name),
+			SizeInBytes: github.Int64(int64(len(a.Data))),
+			ArchiveDownloadURL: github.String(fmt.Sprintf("http://%s/repos/%s/%s/actions/artifacts/%d/zip", r.Host,
+				repo.Owner, repo.Name, a.ID)),
+			Expired:   github.Bool(a.Expired),
+			CreatedAt: &github.Timestamp{Time: a.CreatedAt},
+			ExpiresAt: &github.Timestamp{Time: a.CreatedAt.AddDate(0, 0, 90)},
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) downloadArtifact(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	id, _ := strconv.ParseInt(args[0], 10, 64)
+	for _, a := range repo.Artifacts {
+		if a.ID == id && !a.Expired {
+			// Like GitHub, redirect to a short-lived signed URL that does not require authentication.
+			expires := time.Now().Add(time.Minute).Unix()
+			w.Header().Set("Location", fmt.Sprintf("http://%s/_artifacts/%s/%s/%d.zip?se=%d&sig=%s", r.Host,
+				repo.Owner, repo.Name, id, expires, s.sign(repo, id, expires)))
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) sign(repo *Repository, id, expires int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%d/%d", s.downloadSecret, repo.Owner, repo.Name, id, expires)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) serveArtifactDownload(w http.ResponseWriter, r *http.Request, path string) {
+	parts := strings.Split(strings.TrimPrefix(path, "/_artifacts/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	id, _ := strconv.ParseInt(strings.TrimSuffix(parts[2], ".zip"), 10, 64)
+	expires, _ := strconv.ParseInt(r.URL.Query().Get("se"), 10, 64)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo := s.repo(parts[0], parts[1])
+	if time.Now().Unix() > expires || r.URL.Query().Get("sig") != s.sign(repo, id, expires) {
+		http.Error(w, "AuthenticationFailed", http.StatusForbidden)
+		return
+	}
+	for _, a := range repo.Artifacts {
+		if a.ID == id {
+			w.Header().Set("Content-Type", "application/zip")
+			w.Write(a.Data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) workflowRun(r *http.Request, repo *Repository, run *WorkflowRun) *github.WorkflowRun {
+	updatedAt := run.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = run.CreatedAt
+	}
+	return &github.WorkflowRun{
+		ID:         github.Int64(run.ID),
+		HeadSHA:    github.String(run.HeadSHA),
+		HeadBranch: github.String(run.HeadBranch),
+		Status:     github.String(run.Status),
+		Conclusion: github.String(run.Conclusion),
+		CreatedAt:  &github.Timestamp{Time: run.CreatedAt},
+		UpdatedAt:  &github.Timestamp{Time: updatedAt},
+		HTMLURL:    github.String(fmt.Sprintf("http://%s/%s/%s/actions/runs/%d", r.Host, repo.Owner, repo.Name, run.ID)),
+	}
+}
+
+func (s *Server) listWorkflowRuns(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	var runs []*WorkflowRun
+	for _, run := range repo.WorkflowRuns {
+		if sha := r.URL.Query().Get("head_sha"); sha != "" && run.HeadSHA != sha {
+			continue
+		}
+		if branch := r.URL.Query().Get("branch"); branch != "" && run.HeadBranch != branch {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	// GitHub lists the newest runs first.
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	start, end := paginate(w, r, len(runs))
+	list := &github.WorkflowRuns{
+		TotalCount:   github.Int(len(runs)),
+		WorkflowRuns: []*github.WorkflowRun{},
+	}
+	for _, run := range runs[start:end] {
+		list.WorkflowRuns = append(list.WorkflowRuns, s.workflowRun(r, repo, run))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) getWorkflowRun(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	id, _ := strconv.ParseInt(args[0], 10, 64)
+	for _, run := range repo.WorkflowRuns {
+		if run.ID == id {
+			writeJSON(w, http.StatusOK, s.workflowRun(r, repo, run))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) rerunFailedJobs(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	id, _ := strconv.ParseInt(args[0], 10, 64)
+	for _, run := range repo.WorkflowRuns {
+		if run.ID != id {
+			continue
+		}
+		if run.Status != "completed" || run.Conclusion != "failure" {
+			writeError(w, http.StatusForbidden, "This workflow run cannot be retried")
+			return
+		}
+		run.Attempts++
+		run.Status = "queued"
+		run.Conclusion = ""
+		writeJSON(w, http.StatusCreated, struct{}{})
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) pullRequest(repo *Repository, pr *PullRequest) *github.PullRequest {
+	var labels []*github.Label
+	for _, l := range pr.Labels {
+		labels = append(labels, &github.Label{Name: github.String(l)})
+	}
+	var head string
+	if len(pr.Commits) > 0 {
+		head = pr.Commits[len(pr.Commits)-1]
+	}
+	return &github.PullRequest{
+		Number: github.Int(pr.Number),
+		State:  github.String(pr.State),
+		Merged: github.Bool(pr.Merged),
+		Draft:  github.Bool(pr.Draft),
+		Labels: labels,
+		Head:   &github.PullRequestBranch{SHA: github.String(head)},
+		Base: &github.PullRequestBranch{Repo: &github.Repository{
+			Name:  github.String(repo.Name),
+			Owner: &github.User{Login: github.String(repo.Owner)},
+		}},
+	}
+}
+
+func (s *Server) listPullRequests(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = "open"
+	}
+	var prs []*PullRequest
+	for _, pr := range repo.PullRequests {
+		if state == "all" || pr.State == state {
+			prs = append(prs, pr)
+		}
+	}
+	start, end := paginate(w, r, len(prs))
+	list := []*github.PullRequest{}
+	for _, pr := range prs[start:end] {
+		list = append(list, s.pullRequest(repo, pr))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) findPullRequest(w http.ResponseWriter, repo *Repository, number string) *PullRequest {
+	n, _ := strconv.Atoi(number)
+	for _, pr := range repo.PullRequests {
+		if pr.Number == n {
+			return pr
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+	return nil
+}
+
+func (s *Server) getPullRequest(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	if pr := s.findPullRequest(w, repo, args[0]); pr != nil {
+		writeJSON(w, http.StatusOK, s.pullRequest(repo, pr))
+	}
+}
+
+func (s *Server) listCommits(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	pr := s.findPullRequest(w, repo, args[0])
+	if pr == nil {
+		return
+	}
+	start, end := paginate(w, r, len(pr.Commits))
+	list := []*github.RepositoryCommit{}
+	for _, sha := range pr.Commits[start:end] {
+		list = append(list, &github.RepositoryCommit{SHA: github.String(sha)})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) issueComment(r *http.Request, repo *Repository, number int, c *Comment) *github.IssueComment {
+	createdAt, updatedAt := c.CreatedAt, c.UpdatedAt
+	return &github.IssueComment{
+		ID:        github.Int64(c.ID),
+		NodeID:    github.String(commentNodeID(c.ID)),
+		Body:      github.String(c.Body),
+		User:      &github.User{Login: github.String(c.User)},
+		CreatedAt: &createdAt,
+		UpdatedAt: &updatedAt,
+		HTMLURL: github.String(fmt.Sprintf("http://%s/%s/%s/pull/%d#issuecomment-%d", r.Host, repo.Owner,
+			repo.Name, number, c.ID)),
+	}
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	number, _ := strconv.Atoi(args[0])
+	comments := repo.Comments[number]
+	start, end := paginate(w, r, len(comments))
+	list := []*github.IssueComment{}
+	for _, c := range comments[start:end] {
+		list = append(list, s.issueComment(r, repo, number, c))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	number, _ := strconv.Atoi(args[0])
+	comment := &github.IssueComment{}
+	if err := decode(r, comment); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	now := time.Now()
+	c := &Comment{
+		ID:        s.id(),
+		Body:      comment.GetBody(),
+		User:      Login,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	repo.Comments[number] = append(repo.Comments[number], c)
+	writeJSON(w, http.StatusCreated, s.issueComment(r, repo, number, c))
+}
+
+func (s *Server) findComment(w http.ResponseWriter, repo *Repository, id string) (int, int) {
+	commentID, _ := strconv.ParseInt(id, 10, 64)
+	for number, comments := range repo.Comments {
+		for i, c := range comments {
+			if c.ID == commentID {
+				return number, i
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+	return 0, -1
+}
+
+func (s *Server) editComment(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	number, i := s.findComment(w, repo, args[0])
+	if i < 0 {
+		return
+	}
+	comment := &github.IssueComment{}
+	if err := decode(r, comment); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := repo.Comments[number][i]
+	c.Body = comment.GetBody()
+	c.UpdatedAt = time.Now()
+	writeJSON(w, http.StatusOK, s.issueComment(r, repo, number, c))
+}
+
+func (s *Server) deleteComment(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	number, i := s.findComment(w, repo, args[0])
+	if i < 0 {
+		return
+	}
+	repo.Comments[number] = append(repo.Comments[number][:i], repo.Comments[number][i+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Issues returns a copy of the issues of a repository.
+func (s *Server) Issues(owner, repo string) []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var issues []Issue
+	for _, i := range s.repo(owner, repo).Issues {
+		issue := *i
+		issue.Labels = append([]string(nil), i.Labels...)
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// nextNumber returns the next issue number. Issues and pull requests share their numbers.
+func (repo *Repository) nextNumber() int {
+	number := 0
+	for _, pr := range repo.PullRequests {
+		if pr.Number > number {
+			number = pr.Number
+		}
+	}
+	for _, i := range repo.Issues {
+		if i.Number > number {
+			number = i.Number
+		}
+	}
+	return number + 1
+}
+
+func (s *Server) issue(r *http.Request, repo *Repository, i *Issue) *github.Issue {
+	labels := []*github.Label{}
+	for _, l := range i.Labels {
+		labels = append(labels, &github.Label{Name: github.String(l)})
+	}
+	return &github.Issue{
+		Number: github.Int(i.Number),
+		Title:  github.String(i.Title),
+		Body:   github.String(i.Body),
+		State:  github.String(i.State),
+		Labels: labels,
+		HTMLURL: github.String(fmt.Sprintf("http://%s/%s/%s/issues/%d", r.Host, repo.Owner, repo.Name,
+			i.Number)),
+	}
+}
+
+func hasLabels(i *Issue, labels []string) bool {
+	for _, want := range labels {
+		found := false
+		for _, l := range i.Labels {
+			found = found || l == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) listIssues(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = "open"
+	}
+	var labels []string
+	if l := r.URL.Query().Get("labels"); l != "" {
+		labels = strings.Split(l, ",")
+	}
+	var issues []*Issue
+	for _, i := range repo.Issues {
+		if state != "all" && i.State != state {
+			continue
+		}
+		if !hasLabels(i, labels) {
+			continue
+		}
+		issues = append(issues, i)
+	}
+	start, end := paginate(w, r, len(issues))
+	list := []*github.Issue{}
+	for _, i := range issues[start:end] {
+		list = append(list, s.issue(r, repo, i))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) createIssue(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	request := &github.IssueRequest{}
+	if err := decode(r, request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.GetTitle() == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	i := &Issue{
+		Number: repo.nextNumber(),
+		Title:  request.GetTitle(),
+		Body:   request.GetBody(),
+		State:  "open",
+	}
+	if request.Labels != nil {
+		i.Labels = *request.Labels
+	}
+	repo.Issues = append(repo.Issues, i)
+	writeJSON(w, http.StatusCreated, s.issue(r, repo, i))
+}
+
+func (s *Server) findIssue(w http.ResponseWriter, repo *Repository, number string) *Issue {
+	n, _ := strconv.Atoi(number)
+	for _, i := range repo.Issues {
+		if i.Number == n {
+			return i
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+	return nil
+}
+
+func (s *Server) getIssue(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	if i := s.findIssue(w, repo, args[0]); i != nil {
+		writeJSON(w, http.StatusOK, s.issue(r, repo, i))
+	}
+}
+
+func (s *Server) editIssue(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	i := s.findIssue(w, repo, args[0])
+	if i == nil {
+		return
+	}
+	request := &github.IssueRequest{}
+	if err := decode(r, request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Title != nil {
+		i.Title = request.GetTitle()
+	}
+	if request.Body != nil {
+		i.Body = request.GetBody()
+	}
+	if request.State != nil {
+		i.State = request.GetState()
+	}
+	if request.Labels != nil {
+		i.Labels = *request.Labels
+	}
+	writeJSON(w, http.StatusOK, s.issue(r, repo, i))
+}
+
+// labels returns the labels of the issue or pull request with the given number.
+func (repo *Repository) labels(number string) *[]string {
+	n, _ := strconv.Atoi(number)
+	for _, i := range repo.Issues {
+		if i.Number == n {
+			return &i.Labels
+		}
+	}
+	for _, pr := range repo.PullRequests {
+		if pr.Number == n {
+			return &pr.Labels
+		}
+	}
+	return nil
+}
+
+func (s *Server) addLabels(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	var labels []string
+	if err := decode(r, &labels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	current := repo.labels(args[0])
+	if current == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	for _, l := range labels {
+		if !hasLabels(&Issue{Labels: *current}, []string{l}) {
+			*current = append(*current, l)
+		}
+	}
+	list := []*github.Label{}
+	for _, l := range *current {
+		list = append(list, &github.Label{Name: github.String(l)})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) removeLabel(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	current := repo.labels(args[0])
+	if current == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	for n, l := range *current {
+		if l == args[1] {
+			*current = append((*current)[:n], (*current)[n+1:]...)
+			writeJSON(w, http.StatusOK, []*github.Label{})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Label does not exist")
+}
+
+// CheckRuns returns a copy of the check runs of a repository.
+func (s *Server) CheckRuns(owner, repo string) []CheckRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []CheckRun
+	for _, c := range s.repo(owner, repo).CheckRuns {
+		runs = append(runs, *c)
+	}
+	return runs
+}
+
+// maxAnnotations is the number of annotations GitHub accepts per check run request.
+const maxAnnotations = 50
+
+func (s *Server) checkRun(c *CheckRun) *github.CheckRun {
+	return &github.CheckRun{
+		ID:         github.Int64(c.ID),
+		Name:       github.String(c.Name),
+		HeadSHA:    github.String(c.HeadSHA),
+		Status:     github.String(c.Status),
+		Conclusion: github.String(c.Conclusion),
+		Output: &github.CheckRunOutput{
+			Title:            github.String(c.Title),
+			Summary:          github.String(c.Summary),
+			AnnotationsCount: github.Int(len(c.Annotations)),
+		},
+	}
+}
+
+func (s *Server) createCheckRun(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	options := &github.CreateCheckRunOptions{}
+	if err := decode(r, options); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if options.Name == "" || options.HeadSHA == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Invalid request.")
+		return
+	}
+	c := &CheckRun{
+		ID:         s.id(),
+		Name:       options.Name,
+		HeadSHA:    options.HeadSHA,
+		Status:     options.GetStatus(),
+		Conclusion: options.GetConclusion(),
+	}
+	if !s.updateCheckRunOutput(w, c, options.Output) {
+		return
+	}
+	repo.CheckRuns = append(repo.CheckRuns, c)
+	writeJSON(w, http.StatusCreated, s.checkRun(c))
+}
+
+func (s *Server) updateCheckRun(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	id, _ := strconv.ParseInt(args[0], 10, 64)
+	options := &github.UpdateCheckRunOptions{}
+	if err := decode(r, options); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, c := range repo.CheckRuns {
+		if c.ID != id {
+			continue
+		}
+		if options.Status != nil {
+			c.Status = options.GetStatus()
+		}
+		if options.Conclusion != nil {
+			c.Conclusion = options.GetConclusion()
+		}
+		if s.updateCheckRunOutput(w, c, options.Output) {
+			writeJSON(w, http.StatusOK, s.checkRun(c))
+		}
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// updateCheckRunOutput applies output like GitHub does: annotations are appended, everything else is replaced.
+func (s *Server) updateCheckRunOutput(w http.ResponseWriter, c *CheckRun, output *github.CheckRunOutput) bool {
+	if output == nil {
+		return true
+	}
+	if len(output.Annotations) > maxAnnotations {
+		writeError(w, http.StatusUnprocessableEntity, "Only 50 annotations are allowed per request.")
+		return false
+	}
+	c.Title = output.GetTitle()
+	c.Summary = output.GetSummary()
+	c.Annotations = append(c.Annotations, output.Annotations...)
+	return true
+}
+
+func commentNodeID(id int64) string {
+	return "IC_" + strconv.FormatInt(id, 10)
+}
+
+var (
+	minimizeCommentMutation = regexp.MustCompile(`^\s*mutation\b.*\bminimizeComment\b`)
+	nodesQuery              = regexp.MustCompile(`^\s*query\b.*\bnodes\b.*\bisMinimized\b`)
+)
+
+// graphQL serves the minimizeComment mutation and the query of the minimized state of comments, the only GraphQL
+// calls the analyzer makes.
+func (s *Server) graphQL(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := decode(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := strings.Join(strings.Fields(request.Query), " ")
+	if nodesQuery.MatchString(query) {
+		s.minimizedComments(w, request.Variables["ids"])
+		return
+	}
+	if !minimizeCommentMutation.MatchString(query) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"errors": []map[string]string{{"message": "unsupported query"}},
+		})
+		return
+	}
+
+	id, _ := request.Variables["id"].(string)
+	for _, repo := range s.repos {
+		for _, comments := range repo.Comments {
+			for _, c := range comments {
+				if commentNodeID(c.ID) != id {
+					continue
+				}
+				c.MinimizedReason, _ = request.Variables["classifier"].(string)
+				writeJSON(w, http.StatusOK, map[string]interface{}{
+					"data": map[string]interface{}{
+						"minimizeComment": map[string]interface{}{
+							"minimizedComment": map[string]bool{"isMinimized": true},
+						},
+					},
+				})
+				return
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"errors": []map[string]string{{"message": "Could not resolve to a node with the global id of '" + id + "'"}},
+	})
+}
+
+// minimizedComments answers the nodes query for the minimized state of the comments with the given node IDs.
+func (s *Server) minimizedComments(w http.ResponseWriter, ids interface{}) {
+	list, _ := ids.([]interface{})
+	nodes := []interface{}{}
+	for _, id := range list {
+		var node interface{}
+		for _, repo := range s.repos {
+			for _, comments := range repo.Comments {
+				for _, c := range comments {
+					if commentNodeID(c.ID) == id {
+						node = map[string]interface{}{"id": id, "isMinimized": c.MinimizedReason != ""}
+					}
+				}
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"nodes": nodes}})
+}
+
+func (s *Server) getPermission(w http.ResponseWriter, _ *http.Request, repo *Repository, args []string) {
+	permission, ok := repo.Collaborators[args[0]]
+	if !ok {
+		permission = "read"
+	}
+	writeJSON(w, http.StatusOK, &github.RepositoryPermissionLevel{
+		Permission: github.String(permission),
+		User:       &github.User{Login: github.String(args[0])},
+	})
+}
+
+// commitSHA returns a new, unique commit SHA.
+func (s *Server) commitSHA() string {
+	return fmt.Sprintf("%040x", s.id())
+}
+
+// blobSHA returns the git blob SHA of content, as the contents API does.
+func blobSHA(content []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(append([]byte(fmt.Sprintf("blob %d\x00", len(content))), content...)))
+}
+
+func (s *Server) getRepository(w http.ResponseWriter, _ *http.Request, repo *Repository, _ []string) {
+	writeJSON(w, http.StatusOK, &github.Repository{
+		Name:          github.String(repo.Name),
+		FullName:      github.String(repo.Owner + "/" + repo.Name),
+		Owner:         &github.User{Login: github.String(repo.Owner)},
+		DefaultBranch: github.String(repo.DefaultBranch),
+	})
+}
+
+// branch returns the branch named ref, the default branch if ref is empty, or writes a 404 error.
+func (s *Server) branch(w http.ResponseWriter, repo *Repository, ref string) *Branch {
+	if ref == "" {
+		ref = repo.DefaultBranch
+	}
+	b, ok := repo.Branches[ref]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No commit found for the ref "+ref)
+	}
+	return b
+}
+
+func (s *Server) getContents(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	b := s.branch(w, repo, r.URL.Query().Get("ref"))
+	if b == nil {
+		return
+	}
+	content, ok := b.Files[args[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.RepositoryContent{
+		Type:     github.String("file"),
+		Name:     github.String(args[0][strings.LastIndex(args[0], "/")+1:]),
+		Path:     github.String(args[0]),
+		SHA:      github.String(blobSHA(content)),
+		Size:     github.Int(len(content)),
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString(content)),
+	})
+}
+
+func (s *Server) putContents(w http.ResponseWriter, r *http.Request, repo *Repository, args []string) {
+	request := &github.RepositoryContentFileOptions{}
+	if err := decode(r, request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	b := s.branch(w, repo, request.GetBranch())
+	if b == nil {
+		return
+	}
+	status := http.StatusCreated
+	if previous, ok := b.Files[args[0]]; ok {
+		if request.GetSHA() == "" {
+			writeError(w, http.StatusUnprocessableEntity, `Invalid request.
+
+"sha" wasn't supplied.`)
+			return
+		}
+		if sha := blobSHA(previous); request.GetSHA() != sha {
+			writeError(w, http.StatusConflict, fmt.Sprintf("%s does not match %s", args[0], request.GetSHA()))
+			return
+		}
+		status = http.StatusOK
+	}
+	b.Files[args[0]] = request.Content
+	b.Head = s.commitSHA()
+	writeJSON(w, status, &github.RepositoryContentResponse{
+		Content: &github.RepositoryContent{
+			Type: github.String("file"),
+			Path: github.String(args[0]),
+			SHA:  github.String(blobSHA(request.Content)),
+		},
+		Commit: github.Commit{SHA: github.String(b.Head), Message: request.Message},
+	})
+}
+
+func (s *Server) getBranchRef(w http.ResponseWriter, _ *http.Request, repo *Repository, args []string) {
+	b, ok := repo.Branches[args[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.Reference{
+		Ref:    github.String("refs/heads/" + args[0]),
+		Object: &github.GitObject{Type: github.String("commit"), SHA: github.String(b.Head)},
+	})
+}
+
+// createRef creates a branch pointing at the head of an existing branch. Other references are not supported.
+func (s *Server) createRef(w http.ResponseWriter, r *http.Request, repo *Repository, _ []string) {
+	request := &struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}{}
+	if err := decode(r, request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := strings.TrimPrefix(request.Ref, "refs/heads/")
+	if _, ok := repo.Branches[name]; ok {
+		writeError(w, http.StatusUnprocessableEntity, "Reference already exists")
+		return
+	}
+	for _, b := range repo.Branches {
+		if b.Head != request.SHA {
+			continue
+		}
+		files := map[string][]byte{}
+		for path, content := range b.Files {
+			files[path] = content
+		}
+		repo.Branches[name] = &Branch{Head: b.Head, Files: files}
+		writeJSON(w, http.StatusCreated, &github.Reference{
+			Ref:    github.String(request.Ref),
+			Object: &github.GitObject{Type: github.String("commit"), SHA: github.String(b.Head)},
+		})
+		return
+	}
+	writeError(w, http.StatusUnprocessableEntity, "Object does not exist")
+}
+
+func (s *Server) serveGist(w http.ResponseWriter, r *http.Request, id string) {
+	files, ok := s.gists[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		request := &github.Gist{}
+		if err := decode(r, request); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for name, file := range request.Files {
+			files[string(name)] = file.GetContent()
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	gist := &github.Gist{ID: github.String(id), Files: map[github.GistFilename]github.GistFile{}}
+	for name, content := range files {
+		gist.Files[github.GistFilename(name)] = github.GistFile{
+			Filename: github.String(name),
+			Content:  github.String(content),
+		}
+	}
+	writeJSON(w, http.StatusOK, gist)
+}
+
+func decode(r *http.Request, v interface{}) error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Zip returns a zip archive holding files, for use as artifact content.
+func Zip(files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
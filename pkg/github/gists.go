@@ -0,0 +1,33 @@
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// GetGistFile returns the content of a file of a gist, or nil if the gist has no such file.
+func (r *RepositoryClient) GetGistFile(ctx context.Context, id, name string) ([]byte, error) {
+	gist, _, err := r.Gists.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := gist.Files[github.GistFilename(name)]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(file.GetContent()), nil
+}
+
+// EditGistFile replaces the content of a file of a gist, creating the file if necessary.
+func (r *RepositoryClient) EditGistFile(ctx context.Context, id, name string, content []byte) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("edit gist", "gist "+id+" "+name, string(content))
+	}
+	_, _, err := r.Gists.Edit(ctx, id, &github.Gist{
+		Files: map[github.GistFilename]github.GistFile{
+			github.GistFilename(name): {Content: github.String(string(content))},
+		},
+	})
+	return err
+}
@@ -0,0 +1,93 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// ListIssues returns the open and closed issues carrying all of labels. Pull requests, which the API lists as issues
+// as well, are left out.
+func (r *RepositoryClient) ListIssues(ctx context.Context, labels []string) ([]*github.Issue, error) {
+	done := false
+	page := 0
+	var issues []*github.Issue
+	for !done {
+		list, resp, err := r.Issues.ListByRepo(ctx, r.Owner, r.Repo, &github.IssueListByRepoOptions{
+			State:       "all",
+			Labels:      labels,
+			ListOptions: github.ListOptions{Page: page, PerPage: 100},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range list {
+			if !issue.IsPullRequest() {
+				issues = append(issues, issue)
+			}
+		}
+		if page = resp.NextPage; page == 0 {
+			done = true
+		}
+	}
+	return issues, nil
+}
+
+func (r *RepositoryClient) CreateIssue(ctx context.Context, title, body string, labels []string) (*github.Issue, error) {
+	if r.dryRun != nil {
+		err := r.dryRun.record("issue", r.Owner+"/"+r.Repo, fmt.Sprintf("%s\nLabels: %s\n\n%s", title,
+			strings.Join(labels, ", "), body))
+		return &github.Issue{Title: github.String(title), Body: github.String(body)}, err
+	}
+	issue, _, err := r.Issues.Create(ctx, r.Owner, r.Repo, &github.IssueRequest{
+		Title:  github.String(title),
+		Body:   github.String(body),
+		Labels: &labels,
+	})
+	return issue, err
+}
+
+func (r *RepositoryClient) EditIssue(ctx context.Context, number int, request *github.IssueRequest) error {
+	if r.dryRun != nil {
+		content, err := json.MarshalIndent(request, "", "  ")
+		if err != nil {
+			return err
+		}
+		return r.dryRun.record("edit issue", r.target(number), string(content))
+	}
+	_, _, err := r.Issues.Edit(ctx, r.Owner, r.Repo, number, request)
+	return err
+}
+
+func (r *RepositoryClient) AddLabels(ctx context.Context, number int, labels ...string) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("add labels", r.target(number), strings.Join(labels, "\n"))
+	}
+	_, _, err := r.Issues.AddLabelsToIssue(ctx, r.Owner, r.Repo, number, labels)
+	return err
+}
+
+func (r *RepositoryClient) RemoveLabel(ctx context.Context, number int, label string) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("remove label", r.target(number), label)
+	}
+	_, err := r.Issues.RemoveLabelForIssue(ctx, r.Owner, r.Repo, number, label)
+	return err
+}
+
+func (r *RepositoryClient) GetIssue(ctx context.Context, number int) (*github.Issue, error) {
+	issue, _, err := r.Issues.Get(ctx, r.Owner, r.Repo, number)
+	return issue, err
+}
+
+// CollaboratorPermission returns the permission of a user on the repository: "admin", "write", "read" or "none".
+func (r *RepositoryClient) CollaboratorPermission(ctx context.Context, user string) (string, error) {
+	level, _, err := r.Repositories.GetPermissionLevel(ctx, r.Owner, r.Repo, user)
+	if err != nil {
+		return "", err
+	}
+	return level.GetPermission(), nil
+}
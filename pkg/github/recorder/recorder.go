@@ -0,0 +1,208 @@
+// Package recorder provides a http.RoundTripper that records GitHub API sessions into fixture files and replays them
+// deterministically, so that tests can run without network access or tokens.
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecordEnv is the environment variable that switches recorders created with ModeFromEnv into recording mode.
+const RecordEnv = "FLAKE_ANALYZER_RECORD"
+
+type Mode int
+
+const (
+	// Replay serves responses from the fixture file and fails requests that were not recorded.
+	Replay Mode = iota
+	// Record forwards requests to the underlying transport and writes the session to the fixture file on Stop.
+	Record
+)
+
+// ModeFromEnv returns Record if FLAKE_ANALYZER_RECORD is set to a non-empty value and Replay otherwise.
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return Record
+	}
+	return Replay
+}
+
+// Interaction is a single recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       string              `json:"body,omitempty"`
+}
+
+// Recorder is a http.RoundTripper backed by a fixture file.
+type Recorder struct {
+	fixture   string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	Interactions []*Interaction `json:"interactions"`
+	used         map[*Interaction]bool
+}
+
+// headers not worth keeping in fixtures. Request headers, including Authorization, are never recorded.
+var skippedHeaders = map[string]bool{
+	"Set-Cookie":                true,
+	"Date":                      true,
+	"X-Github-Request-Id":       true,
+	"Strict-Transport-Security": true,
+}
+
+// New returns a Recorder for the fixture file. In Replay mode the fixture is loaded immediately. A nil transport
+// defaults to http.DefaultTransport.
+func New(fixture string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{
+		fixture:   fixture,
+		mode:      mode,
+		transport: transport,
+		used:      map[*Interaction]bool{},
+	}
+	if mode == Replay {
+		data, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load fixture %s, record it with %s=1: %v", fixture, RecordEnv, err)
+		}
+		if err := yaml.Unmarshal(data, r); err != nil {
+			return nil, fmt.Errorf("failed to decode fixture %s, %v", fixture, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	request := Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Body:   string(body),
+	}
+
+	if r.mode == Replay {
+		return r.replay(req, request)
+	}
+
+	forwarded := req.Clone(req.Context())
+	forwarded.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := r.transport.RoundTrip(forwarded)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	header := map[string][]string{}
+	for k, v := range resp.Header {
+		if !skippedHeaders[k] {
+			header[k] = v
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Interactions = append(r.Interactions, &Interaction{
+		Request: request,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       string(respBody),
+		},
+	})
+	return resp, nil
+}
+
+// replay serves the first unused interaction matching method and URL. Interactions are consumed so that repeated
+// requests, e.g. polling, are answered in the recorded order. Request bodies are recorded for reference only, as
+// generated reports are not byte-for-byte stable.
+func (r *Recorder) replay(req *http.Request, request Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, i := range r.Interactions {
+		if r.used[i] || i.Request.Method != request.Method || i.Request.URL != request.URL {
+			continue
+		}
+		r.used[i] = true
+
+		header := http.Header{}
+		for k, v := range i.Response.Header {
+			header[k] = v
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+			StatusCode:    i.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction left for %s %s in %s", request.Method, request.URL, r.fixture)
+}
+
+// Stop writes the recorded session to the fixture file. It is a no-op in Replay mode.
+func (r *Recorder) Stop() error {
+	if r.mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.fixture), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.fixture, data, 0644)
+}
+
+// Token returns GITHUB_TOKEN when recording and a placeholder when replaying, since fixtures never contain
+// credentials.
+func Token(mode Mode) string {
+	if mode == Record {
+		return os.Getenv("GITHUB_TOKEN")
+	}
+	return "replayed-token"
+}
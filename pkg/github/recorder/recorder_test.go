@@ -0,0 +1,63 @@
+package recorder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var served int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.Header().Set("Link", `<https://api.github.com/repos/o/r/pulls?page=2>; rel="next"`)
+		fmt.Fprintf(w, `{"run":%d}`, served)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recorder-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "fixtures", "session.yaml")
+
+	get := func(client *http.Client) (string, http.Header) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/repos/o/r/pulls", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "token secret")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body), resp.Header
+	}
+
+	rec, err := New(fixture, Record, nil)
+	require.NoError(t, err)
+	first, _ := get(&http.Client{Transport: rec})
+	second, _ := get(&http.Client{Transport: rec})
+	require.NoError(t, rec.Stop())
+
+	data, err := ioutil.ReadFile(fixture)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	rec, err = New(fixture, Replay, nil)
+	require.NoError(t, err)
+	body, header := get(&http.Client{Transport: rec})
+	assert.Equal(t, first, body)
+	assert.Equal(t, `<https://api.github.com/repos/o/r/pulls?page=2>; rel="next"`, header.Get("Link"))
+	body, _ = get(&http.Client{Transport: rec})
+	assert.Equal(t, second, body)
+	assert.Equal(t, 2, served)
+
+	_, err = (&http.Client{Transport: rec}).Get(server.URL + "/repos/o/r/pulls")
+	assert.Error(t, err)
+}
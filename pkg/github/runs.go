@@ -0,0 +1,84 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+// ListBranchHeadSHAs returns the head commits of the workflow runs on branch created after since, newest first. A
+// nil since lists all runs.
+func (r *RepositoryClient) ListBranchHeadSHAs(ctx context.Context, branch string, since *time.Time) ([]string, error) {
+	page := 0
+	seen := map[string]bool{}
+	var commits []string
+	for {
+		runs, resp, err := r.Actions.ListRepositoryWorkflowRuns(ctx, r.Owner, r.Repo, &github.ListWorkflowRunsOptions{
+			Branch:      branch,
+			ListOptions: github.ListOptions{Page: page, PerPage: 100},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs.WorkflowRuns {
+			// Runs are listed newest first, so the remaining runs are older as well.
+			if since != nil && run.GetCreatedAt().Time.Before(*since) {
+				return commits, nil
+			}
+			if sha := run.GetHeadSHA(); !seen[sha] {
+				seen[sha] = true
+				commits = append(commits, sha)
+			}
+		}
+		if page = resp.NextPage; page == 0 {
+			return commits, nil
+		}
+	}
+}
+
+// RerunFailedJobs re-runs the failed jobs of a completed workflow run, and the jobs they depend on, as a new attempt
+// of the same run.
+func (r *RepositoryClient) RerunFailedJobs(ctx context.Context, runID int64) error {
+	if r.dryRun != nil {
+		return r.dryRun.record("rerun failed jobs", fmt.Sprintf("%s/%s run %d", r.Owner, r.Repo, runID), "")
+	}
+	u := fmt.Sprintf("repos/%s/%s/actions/runs/%d/rerun-failed-jobs", r.Owner, r.Repo, runID)
+	req, err := r.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Do(ctx, req, nil); err != nil {
+		return fmt.Errorf("failed to re-run the failed jobs of run %d, %v", runID, err)
+	}
+	return nil
+}
+
+// ListCommitRuns returns the workflow runs on a head commit, newest first.
+func (r *RepositoryClient) ListCommitRuns(ctx context.Context, sha string) ([]*github.WorkflowRun, error) {
+	page := 0
+	var runs []*github.WorkflowRun
+	for {
+		// go-github does not support filtering runs by head commit.
+		query := url.Values{"head_sha": {sha}, "per_page": {"100"}}
+		if page != 0 {
+			query.Set("page", strconv.Itoa(page))
+		}
+		req, err := r.NewRequest("GET", fmt.Sprintf("repos/%s/%s/actions/runs?%s", r.Owner, r.Repo, query.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+		list := &github.WorkflowRuns{}
+		resp, err := r.Do(ctx, req, list)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, list.WorkflowRuns...)
+		if page = resp.NextPage; page == 0 {
+			return runs, nil
+		}
+	}
+}
@@ -1,17 +1,37 @@
 package e2e
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/flak-analyzer/pkg/artifacts/commenter"
+	"github.com/operator-framework/flak-analyzer/pkg/github/fake"
 )
 
 const (
-	owner string = "operator-framework"
-	repo  string = "Operator-lifecycle-manager"
+	owner         string = "operator-framework"
+	repo          string = "Operator-lifecycle-manager"
+	commenterRepo string = "flake-analyzer"
+	testSuite     string = "e2e-test-output"
+	zipDir        string = "./pkg/artifacts/reporter/testData/zip/"
 )
 
 func TestMain(m *testing.M) {
@@ -32,34 +52,932 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func TestPeriodicAnalysis(t *testing.T) {
-	err := os.Chdir("../..")
-	if err != nil {
-		fmt.Printf("could not change dir: %v", err)
-		os.Exit(1)
+// newServer serves the test artifacts of the reporter package from a fake GitHub. Pull request 1641 failed twice,
+// pull request 1650 passed.
+func newServer(t *testing.T) *fake.Server {
+	s := fake.NewServer()
+	files, err := ioutil.ReadDir(zipDir)
+	require.NoError(t, err)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(zipDir, f.Name()))
+		require.NoError(t, err)
+		s.AddArtifact(owner, repo, strings.TrimSuffix(f.Name(), ".zip"), time.Now().AddDate(0, 0, -1), data)
 	}
 
-	token := os.Getenv("GITHUB_TOKEN")
+	s.AddPullRequest(owner, repo, 1641, "2dee293e111779104380644c57c2bfe0cca79b98",
+		"5a1aecd11b1db0130121c690842bcf942b5fd700")
+	s.AddWorkflowRun(owner, repo, 163340205, "2dee293e111779104380644c57c2bfe0cca79b98", "failure")
+	s.AddWorkflowRun(owner, repo, 163705692, "5a1aecd11b1db0130121c690842bcf942b5fd700", "failure")
+
+	s.AddPullRequest(owner, repo, 1650, "0e965be4bab0f5f7d8d269616c0988e9199cb9d6")
+	s.AddWorkflowRun(owner, repo, 162516802, "0e965be4bab0f5f7d8d269616c0988e9199cb9d6", "success")
+	return s
+}
+
+func run(t *testing.T, s *fake.Server, binary string, args ...string) ([]byte, error) {
+	cmd := exec.Command(binary, append([]string{"-n=" + owner, "-r=" + repo, "--github-url=" + s.URL}, args...)...)
+	cmd.Env = append(os.Environ(), "GITHUB_TOKEN=e2e-token")
+	output, err := cmd.CombinedOutput()
+	t.Log(string(output))
+	return output, err
+}
+
+func TestPeriodicAnalysis(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
 
 	tests := []struct {
-		name string
-		args []string
+		name       string
+		args       []string
+		totalCount string
 	}{
 		{name: "Generate report by time frame",
-			args: []string{"--from=7", "--to=0", "-f=e2e-test-output", "-o=./recentreport"},
+			args:       []string{"--from=7", "--to=0", "-f=" + testSuite},
+			totalCount: "totaltestcount: 4",
+		},
+		{name: "Generate report by commit",
+			args:       []string{"-f=" + testSuite, "-c=0e965be4bab0f5f7d8d269616c0988e9199cb9d6"},
+			totalCount: "totaltestcount: 1",
 		},
 	}
 
-	for _, tt := range tests {
+	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cmd:= exec.Command("./bin/flake-analyzer", append([]string{"-n=" + owner, "-r=" + repo, "-t=" + token},
-			tt.args...)...)
+			reportFile := filepath.Join(dir, fmt.Sprintf("report-%d.yaml", i))
+			_, err := run(t, s, "./bin/flake-analyzer", append(tt.args, "-o="+reportFile, "-d="+dir)...)
+			require.NoError(t, err)
+
+			report, err := ioutil.ReadFile(reportFile)
+			require.NoError(t, err)
+			assert.Contains(t, string(report), tt.totalCount)
+			assert.Contains(t, string(report), "flaketests:")
+		})
+	}
+}
+
+func TestPeriodicAnalysisWithoutCredentials(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Public repositories are read unauthenticated when no credential source has a token.
+	cmd := exec.Command("./bin/flake-analyzer", "-n="+owner, "-r="+repo, "--github-url="+s.URL, "--netrc=",
+		"--from=7", "--to=0", "-f="+testSuite, "-o="+filepath.Join(dir, "report.yaml"), "-d="+dir)
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "GITHUB_TOKEN") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	output, err := cmd.CombinedOutput()
+	t.Log(string(output))
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "calling the API unauthenticated")
+
+	report, err := ioutil.ReadFile(filepath.Join(dir, "report.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "totaltestcount: 4")
+	for _, token := range s.Tokens() {
+		assert.Empty(t, token)
+	}
+}
+
+func TestPullRequestReport(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = run(t, s, "./bin/flake-analyzer", "-f="+testSuite, "-p=1641", "-o="+filepath.Join(dir, "report.yaml"),
+		"-d="+dir)
+	require.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Body, "This PR **failed 2 out of 2 times**")
+}
+
+func TestPullRequestReportStickyComment(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	args := []string{"-f=" + testSuite, "-p=1641", "-o=" + filepath.Join(dir, "report.yaml"), "-d=" + dir}
+	// Comments of others carrying the report marker are neither edited nor minimized.
+	marker := "<!-- flake-analyzer report: " + testSuite + " -->\n"
+	s.Update(owner, repo, func(r *fake.Repository) {
+		r.Comments[1641] = []*fake.Comment{{ID: 1, Body: "LGTM", User: "reviewer"},
+			{ID: 2, Body: marker + "Not a report", User: "someone"}}
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err = run(t, s, "./bin/flake-analyzer", append(args, "--comment-history=1")...)
+		require.NoError(t, err)
+	}
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 3)
+	assert.Equal(t, "LGTM", comments[0].Body)
+	assert.Equal(t, marker+"Not a report", comments[1].Body)
+	body := comments[2].Body
+	assert.True(t, strings.HasPrefix(body, marker))
+	assert.Equal(t, 2, strings.Count(body, "This PR **failed 2 out of 2 times**"), "only one previous report is kept")
+	assert.Contains(t, body, "Previous reports (1)")
+
+	for i := 0; i < 2; i++ {
+		_, err = run(t, s, "./bin/flake-analyzer", append(args, "--comment-mode=minimize")...)
+		require.NoError(t, err)
+	}
+	comments = s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 5)
+	assert.Empty(t, comments[0].MinimizedReason)
+	assert.Empty(t, comments[1].MinimizedReason)
+	assert.Equal(t, "OUTDATED", comments[2].MinimizedReason)
+	assert.Equal(t, "OUTDATED", comments[3].MinimizedReason)
+	assert.Empty(t, comments[4].MinimizedReason)
+	assert.NotContains(t, comments[4].Body, "Previous reports")
+	// Each report minimizes the comments it outdates only: one query and one mutation per run.
+	var graphQL int
+	for _, r := range s.Requests() {
+		if r == "POST /graphql" || r == "POST /api/graphql" {
+			graphQL++
+		}
+	}
+	assert.Equal(t, 4, graphQL)
+
+	_, err = run(t, s, "./bin/flake-analyzer", append(args, "--comment-mode=bogus")...)
+	require.Error(t, err)
+}
+
+func TestPullRequestReportComparedWithBranch(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	master := s.AddWorkflowRun(owner, repo, 163419394, "1af968cb786e652f76cc0d9e5dd7d079bea984cb", "failure")
+	s.Update(owner, repo, func(*fake.Repository) { master.HeadBranch = "master" })
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = run(t, s, "./bin/flake-analyzer", "-f="+testSuite, "-p=1641", "-o="+filepath.Join(dir, "report.yaml"),
+		"-d="+dir, "--baseline-branch=master")
+	require.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Body, "Compared with master in the last 7 days: 3 known flakes, 0 known tests"+
+		" with new errors and 4 new failures.")
+	assert.Contains(t, comments[0].Body, "name: '**Subscription creation manual approval**'\n"+
+		"    classification: new failure, not seen on master in the last 7 days")
+	assert.Contains(t, comments[0].Body, "classification: known flake (failed 1× on master in the last 7 days)")
+}
+
+func TestCommenter(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	progressFile := filepath.Join(dir, "commenter-progress.yaml")
+
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "-p=" + progressFile,
+		"-i=flake-bot-artifact"}
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Body, "This PR **failed 2 out of 2 times**")
+	assert.Empty(t, s.Comments(owner, repo, 1650))
+
+	progress, err := ioutil.ReadFile(progressFile)
+	require.NoError(t, err)
+	for _, id := range []string{"163340205", "163705692", "162516802"} {
+		assert.Contains(t, string(progress), id)
+	}
+
+	// Upload the progress like the commenter workflow does, then poll again without new runs.
+	data, err := fake.Zip(map[string][]byte{filepath.Base(progressFile): progress})
+	require.NoError(t, err)
+	s.AddArtifact(owner, commenterRepo, "flake-bot-artifact", time.Now(), data)
+
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+}
+
+func TestCommenterProgressBranch(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "--progress-store=branch",
+		"--progress-branch=progress"}
+	_, err := run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	require.Len(t, s.Comments(owner, repo, 1641), 1)
+
+	progress := s.File(owner, commenterRepo, "progress", "commenter-progress.json")
+	require.NotNil(t, progress)
+	assert.Contains(t, string(progress), `"version": 2`)
+	for _, id := range []string{"163340205", "163705692", "162516802"} {
+		assert.Contains(t, string(progress), id)
+	}
+	assert.Contains(t, string(progress), `"pr": 1641`)
+	assert.Contains(t, string(progress), `"commented": true`)
+	assert.Contains(t, string(progress), fmt.Sprintf(`"comment_id": %d`, s.Comments(owner, repo, 1641)[0].ID))
+
+	// The progress is read back from the branch, no artifact needs to be uploaded.
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+}
+
+func TestCommenterWatch(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	progressFile := filepath.Join(dir, "commenter-progress.yaml")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	healthAddr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	cmd := exec.Command("./bin/commenter", "-n="+owner, "-r="+repo, "--github-url="+s.URL, "-m="+owner,
+		"-l="+commenterRepo, "-f="+testSuite, "--progress-store=file", "-p="+progressFile, "--watch",
+		"--interval=100ms", "--health-addr="+healthAddr)
+	cmd.Env = append(os.Environ(), "GITHUB_TOKEN=e2e-token")
+	output, err := ioutil.TempFile(dir, "output-")
+	require.NoError(t, err)
+	cmd.Stdout, cmd.Stderr = output, output
+	require.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		log, _ := ioutil.ReadFile(output.Name())
+		t.Log(string(log))
+	}()
+
+	var health struct {
+		Polls   int  `json:"polls"`
+		Healthy bool `json:"healthy"`
+	}
+	waitForPolls := func(polls int) {
+		require.Eventually(t, func() bool {
+			resp, err := http.Get("http://" + healthAddr + "/healthz")
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			return json.NewDecoder(resp.Body).Decode(&health) == nil && resp.StatusCode == http.StatusOK &&
+				health.Polls >= polls
+		}, 10*time.Second, 50*time.Millisecond)
+	}
+	commitRequests := func() int {
+		var n int
+		for _, r := range s.Requests() {
+			if strings.HasSuffix(r, "/pulls/1641/commits") {
+				n++
+			}
+		}
+		return n
+	}
+
+	waitForPolls(1)
+	assert.True(t, health.Healthy)
+	require.Len(t, s.Comments(owner, repo, 1641), 1)
+
+	// Later polls neither comment again nor list the commits of pull requests whose head did not change.
+	requests := commitRequests()
+	waitForPolls(health.Polls + 2)
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+	assert.Equal(t, requests, commitRequests())
+
+	require.NoError(t, cmd.Process.Signal(syscall.SIGTERM))
+	require.NoError(t, cmd.Wait())
+	progress, err := ioutil.ReadFile(progressFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(progress), "163705692")
+	_, err = os.Stat(progressFile + ".lock")
+	assert.True(t, os.IsNotExist(err), "the progress file is still locked")
+}
+
+func TestCommenterWebhook(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	cmd := exec.Command("./bin/commenter", "-n="+owner, "-r="+repo, "--github-url="+s.URL, "-m="+owner,
+		"-l="+commenterRepo, "-f="+testSuite, "--progress-store=file", "-p="+filepath.Join(dir, "progress.yaml"),
+		"--webhook-addr="+addr)
+	cmd.Env = append(os.Environ(), "GITHUB_TOKEN=e2e-token", "WEBHOOK_SECRET=e2e-secret")
+	output, err := ioutil.TempFile(dir, "output-")
+	require.NoError(t, err)
+	cmd.Stdout, cmd.Stderr = output, output
+	require.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		log, _ := ioutil.ReadFile(output.Name())
+		t.Log(string(log))
+	}()
+
+	// Idle connections dialed by the client but never used would delay the shutdown of the webhook server.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	deliver := func(event, delivery, payload string) int {
+		mac := hmac.New(sha256.New, []byte("e2e-secret"))
+		mac.Write([]byte(payload))
+		r, err := http.NewRequest(http.MethodPost, "http://"+addr+"/webhook", bytes.NewBufferString(payload))
+		require.NoError(t, err)
+		r.Header.Set("X-GitHub-Event", event)
+		r.Header.Set("X-GitHub-Delivery", delivery)
+		r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		resp, err := client.Do(r)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	repository := fmt.Sprintf(`"repository": {"name": %q, "owner": {"login": %q}}`, repo, owner)
+	synchronize := `{"action": "synchronize", "number": 1641, ` + repository + `}`
+	require.Eventually(t, func() bool {
+		return deliver("pull_request", "delivery-1", synchronize) == http.StatusAccepted
+	}, 10*time.Second, 50*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return len(s.Comments(owner, repo, 1641)) == 1
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, http.StatusOK, deliver("pull_request", "delivery-1", synchronize), "redelivery is not ignored")
+
+	// The run was reported on, its completion does not post another comment.
+	completed := `{"action": "completed", "workflow_run": {"id": 163705692, "pull_requests": [{"number": 1641}]}, ` +
+		repository + `}`
+	assert.Equal(t, http.StatusAccepted, deliver("workflow_run", "delivery-2", completed))
+
+	require.NoError(t, cmd.Process.Signal(syscall.SIGTERM))
+	require.NoError(t, cmd.Wait())
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+	assert.Empty(t, s.Comments(owner, repo, 1650))
+}
+
+func TestCommenterCheckRun(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = run(t, s, "./bin/commenter", "-m="+owner, "-l="+commenterRepo, "-f="+testSuite,
+		"-p="+filepath.Join(dir, "commenter-progress.yaml"), "--check-run", "--comment=false")
+	require.NoError(t, err)
+	assert.Empty(t, s.Comments(owner, repo, 1641))
+
+	runs := s.CheckRuns(owner, repo)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "Flake Analyzer ("+testSuite+")", runs[0].Name)
+	assert.Equal(t, "5a1aecd11b1db0130121c690842bcf942b5fd700", runs[0].HeadSHA)
+	assert.Equal(t, "neutral", runs[0].Conclusion)
+	assert.Contains(t, runs[0].Summary, "| End-to-end **Subscription creation using existing CSV** | 2 | 2 |")
+
+	paths := map[string]bool{}
+	for _, a := range runs[0].Annotations {
+		paths[fmt.Sprintf("%s:%d", a.GetPath(), a.GetStartLine())] = true
+		assert.Equal(t, "failure", a.GetAnnotationLevel())
+	}
+	assert.True(t, paths["test/e2e/bundle_e2e_test.go:78"], "annotations: %v", paths)
+}
+
+func TestCommenterRateLimited(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
 
-			output,err:=cmd.CombinedOutput()
-			assert.NoError(t,err)
-			assert.NotEmpty(t,output)
-			fmt.Println(output)
+	s.SetRateLimit(3, time.Now().Add(time.Hour))
+	output, err := run(t, s, "./bin/commenter", "-m="+owner, "-l="+commenterRepo, "-f="+testSuite,
+		"-p="+filepath.Join(dir, "commenter-progress.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "rate limit")
+	assert.Empty(t, s.Comments(owner, repo, 1641))
+}
+
+func TestPeriodicAnalysisIssues(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	// A test that stopped failing a month ago.
+	s.Update(owner, repo, func(r *fake.Repository) {
+		r.Issues = append(r.Issues, &fake.Issue{
+			Number: 1, Title: "Flaky test: fixed", State: "open", Labels: []string{"flaky-test"},
+			Body: `<!-- flake-analyzer issue: {"test":"suite/fixed","test_suite":"` + testSuite +
+				`","fingerprints":[],"last_failure":"` + time.Now().AddDate(0, -1, 0).Format(time.RFC3339) + `"} -->`,
 		})
+	})
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	args := []string{"--from=7", "--to=0", "-f=" + testSuite, "-o=" + filepath.Join(dir, "report.yaml"), "-d=" + dir,
+		"--issues", "--issue-threshold=1"}
+	_, err = run(t, s, "./bin/flake-analyzer", args...)
+	require.NoError(t, err)
+
+	issues := s.Issues(owner, repo)
+	require.True(t, len(issues) > 1)
+	assert.Equal(t, "closed", issues[0].State)
+	for _, issue := range issues[1:] {
+		assert.Equal(t, "open", issue.State)
+		assert.Equal(t, []string{"flaky-test"}, issue.Labels)
+		assert.Contains(t, issue.Title, "Flaky test: ")
+		assert.Contains(t, issue.Body, "<!-- flake-analyzer issue: ")
+	}
+
+	// Issues are updated instead of filed again.
+	_, err = run(t, s, "./bin/flake-analyzer", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Issues(owner, repo), len(issues))
+	assert.Len(t, s.Comments(owner, repo, 1), 1)
+}
+
+func TestCommenterRerunKnownFlakes(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	// Pull request 1700 failed with the same errors as master, pull request 1641 has new failures.
+	master := s.AddWorkflowRun(owner, repo, 163419394, "1af968cb786e652f76cc0d9e5dd7d079bea984cb", "failure")
+	s.Update(owner, repo, func(*fake.Repository) { master.HeadBranch = "master" })
+	failed, err := ioutil.ReadFile(filepath.Join(zipDir,
+		"e2e-test-output-1af968cb786e652f76cc0d9e5dd7d079bea984cb-163419394.zip"))
+	require.NoError(t, err)
+	head := "c4d2a7e9f0b1c3d5e7f9a1b3c5d7e9f1a3b5c7d9"
+	artifact := "e2e-test-output-" + head + "-170000002"
+	s.AddArtifact(owner, repo, artifact, time.Now(), failed)
+	flaky := s.AddWorkflowRun(owner, repo, 170000002, head, "failure")
+	s.AddPullRequest(owner, repo, 1700, head)
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	progressFile := filepath.Join(dir, "commenter-progress.yaml")
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "-p=" + progressFile,
+		"-i=flake-bot-artifact", "--baseline-branch=master", "--rerun-budget=1", "--label-prs"}
+
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+
+	s.Update(owner, repo, func(r *fake.Repository) {
+		assert.Equal(t, 1, flaky.Attempts)
+		for _, run := range r.WorkflowRuns {
+			if run.ID != flaky.ID {
+				assert.Zero(t, run.Attempts, "run %d", run.ID)
+			}
+		}
+	})
+
+	comments := s.Comments(owner, repo, 1700)
+	require.Len(t, comments, 2)
+	assert.Contains(t, comments[0].Body, "Re-running the failed jobs of [run 170000002]")
+	assert.Contains(t, comments[0].Body, "(rerun 1 of 1 on this pull request): all 5 failed tests are known flakes")
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+	s.Update(owner, repo, func(r *fake.Repository) {
+		assert.Equal(t, []string{"flaky-ci"}, r.PullRequests[2].Labels)
+	})
+
+	progress, err := commenter.NewFileStore(progressFile).Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, progress.Commented, 1)
+	reruns := progress.Commented[0].Reruns["1700"]
+	require.Len(t, reruns, 1)
+	assert.Equal(t, flaky.ID, reruns[0].RunID)
+	assert.Equal(t, head, reruns[0].Commit)
+	assert.Len(t, reruns[0].Tests, 5)
+
+	// The second attempt of the run passes and uploads its own artifact under the same name.
+	passed, err := fake.Zip(map[string][]byte{"junit_e2e.xml": []byte(`<testsuite name="e2e" tests="1">` +
+		`<testcase classname="e2e" name="passes" time="1.0"></testcase></testsuite>`)})
+	require.NoError(t, err)
+	s.AddArtifact(owner, repo, artifact, time.Now(), passed)
+	s.Update(owner, repo, func(*fake.Repository) { flaky.Status, flaky.Conclusion = "completed", "success" })
+
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+
+	s.Update(owner, repo, func(r *fake.Repository) {
+		assert.Empty(t, r.PullRequests[2].Labels)
+		assert.Equal(t, 1, flaky.Attempts)
+	})
+	assert.Len(t, s.Comments(owner, repo, 1700), 2)
+	progress, err = commenter.NewFileStore(progressFile).Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, progress.Commented[0].Runs["170000002"].Artifacts)
+}
+
+func TestCommenterSlashCommands(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	// Pull request 1700 failed with the same tests as master, pull request 1641 has new failures.
+	master := s.AddWorkflowRun(owner, repo, 163419394, "1af968cb786e652f76cc0d9e5dd7d079bea984cb", "failure")
+	s.Update(owner, repo, func(*fake.Repository) { master.HeadBranch = "master" })
+	s.AddPullRequest(owner, repo, 1700, "1af968cb786e652f76cc0d9e5dd7d079bea984cb")
+	s.Update(owner, repo, func(r *fake.Repository) { r.Collaborators["maintainer"] = "write" })
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "--progress-store=file",
+		"-p=" + filepath.Join(dir, "commenter-progress.yaml"), "--baseline-branch=master", "--slash-commands"}
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	require.Len(t, s.Comments(owner, repo, 1641), 1)
+	require.Len(t, s.Comments(owner, repo, 1700), 1)
+
+	s.AddComment(owner, repo, 1641, "maintainer", "Let's see.\n/flake explain Subscription creation manual approval\n"+
+		"/flake mute Subscription creation manual approval")
+	s.AddComment(owner, repo, 1641, "stranger", "/flake report")
+	s.AddComment(owner, repo, 1700, "maintainer", "/flake rerun")
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 6)
+	assert.Contains(t, comments[3].Body, "> /flake explain Subscription creation manual approval\n\n@maintainer")
+	assert.Contains(t, comments[3].Body, "**Subscription creation manual approval** (`")
+	assert.Contains(t, comments[3].Body, "It did not fail on master in the last 7 days.")
+	assert.Contains(t, comments[4].Body, "ignore:\n  - test: \"Subscription creation manual approval\"")
+	assert.Contains(t, comments[5].Body, "@stranger Only collaborators with write access")
+
+	s.Update(owner, repo, func(*fake.Repository) { assert.Equal(t, 1, master.Attempts) })
+	comments = s.Comments(owner, repo, 1700)
+	require.Len(t, comments, 3)
+	assert.Contains(t, comments[2].Body, "Re-running the failed jobs of [run 163419394](")
+	assert.Contains(t, comments[2].Body, "(rerun 1 on this pull request): all 5 failed tests are known flakes")
+
+	// Commands are run once.
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1641), 6)
+	assert.Len(t, s.Comments(owner, repo, 1700), 3)
+	s.Update(owner, repo, func(*fake.Repository) { assert.Equal(t, 1, master.Attempts) })
+}
+
+func TestCommenterSlashCommandsSuites(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	// Pull request 1700 failed like master in both test suites of the repository, with a single run.
+	sha := "1af968cb786e652f76cc0d9e5dd7d079bea984cb"
+	master := s.AddWorkflowRun(owner, repo, 163419394, sha, "failure")
+	s.Update(owner, repo, func(*fake.Repository) { master.HeadBranch = "master" })
+	data, err := ioutil.ReadFile(filepath.Join(zipDir, "e2e-test-output-"+sha+"-163419394.zip"))
+	require.NoError(t, err)
+	s.AddArtifact(owner, repo, "unit-"+sha+"-163419394", time.Now(), data)
+	s.AddPullRequest(owner, repo, 1700, sha)
+	s.Update(owner, repo, func(r *fake.Repository) { r.Collaborators["maintainer"] = "write" })
+	s.AddFile(owner, repo, "master", ".github/flake-analyzer.yaml", []byte(`suites:
+  - name: e2e
+    artifacts: e2e-test-output
+  - name: unit
+    artifacts: unit
+`))
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "--progress-store=file",
+		"-p=" + filepath.Join(dir, "commenter-progress.yaml"), "--baseline-branch=master", "--slash-commands"}
+	output, err := run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	require.Len(t, s.Comments(owner, repo, 1700), 2, "one report per test suite")
+	assert.Contains(t, string(output), owner+"/"+repo+": 2 test suites, 3 open pull requests, 3 reported on")
+
+	s.AddComment(owner, repo, 1700, "maintainer", "/flake rerun")
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1700)
+	require.Len(t, comments, 4, "a single reply for both test suites")
+	assert.Contains(t, comments[3].Body, "Re-running the failed jobs of [run 163419394](")
+	s.Update(owner, repo, func(*fake.Repository) { assert.Equal(t, 1, master.Attempts) })
+
+	// Commands are run once.
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1700), 4)
+	s.Update(owner, repo, func(*fake.Repository) { assert.Equal(t, 1, master.Attempts) })
+}
+
+func TestCommenterLabelPRs(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	master := s.AddWorkflowRun(owner, repo, 163419394, "1af968cb786e652f76cc0d9e5dd7d079bea984cb", "failure")
+	s.Update(owner, repo, func(*fake.Repository) { master.HeadBranch = "master" })
+	// Pull request 1700 failed with the same tests as master, pull request 1710 failed without failed tests.
+	s.AddPullRequest(owner, repo, 1700, "1af968cb786e652f76cc0d9e5dd7d079bea984cb")
+	passed, err := fake.Zip(map[string][]byte{"junit_e2e.xml": []byte(`<testsuite name="e2e" tests="1">` +
+		`<testcase classname="e2e" name="passes" time="1.0"></testcase></testsuite>`)})
+	require.NoError(t, err)
+	broken := "b0e3f1a4c5d6e7f8091a2b3c4d5e6f708192a3b4"
+	s.AddArtifact(owner, repo, "e2e-test-output-"+broken+"-170000001", time.Now(), passed)
+	s.AddWorkflowRun(owner, repo, 170000001, broken, "failure")
+	s.AddPullRequest(owner, repo, 1710, broken)
+	s.Update(owner, repo, func(r *fake.Repository) { r.PullRequests[1].Labels = []string{"flaky-ci", "lgtm"} })
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = run(t, s, "./bin/commenter", "-m="+owner, "-l="+commenterRepo, "-f="+testSuite,
+		"-p="+filepath.Join(dir, "commenter-progress.yaml"), "-i=flake-bot-artifact", "--baseline-branch=master",
+		"--label-prs")
+	require.NoError(t, err)
+
+	labels := map[int][]string{}
+	s.Update(owner, repo, func(r *fake.Repository) {
+		for _, pr := range r.PullRequests {
+			labels[pr.Number] = pr.Labels
+		}
+	})
+	assert.Equal(t, map[int][]string{
+		1641: {"needs-investigation"},
+		1650: {"lgtm"},
+		1700: {"flaky-ci"},
+		1710: {"ci-broken"},
+	}, labels)
+}
+
+func TestCommenterDryRun(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	master := s.AddWorkflowRun(owner, repo, 163419394, "1af968cb786e652f76cc0d9e5dd7d079bea984cb", "failure")
+	s.Update(owner, repo, func(*fake.Repository) { master.HeadBranch = "master" })
+	s.AddPullRequest(owner, repo, 1700, "1af968cb786e652f76cc0d9e5dd7d079bea984cb")
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	progressFile := filepath.Join(dir, "commenter-progress.yaml")
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "--progress-store=file",
+		"-p=" + progressFile, "--baseline-branch=master", "--rerun-budget=1", "--label-prs", "--dry-run"}
+
+	output, err := run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "--- dry run: comment "+owner+"/"+repo+"#1641 ---\n")
+	assert.Contains(t, string(output), "--- dry run: add labels "+owner+"/"+repo+"#1700 ---\nflaky-ci\n")
+	assert.Contains(t, string(output), "--- dry run: rerun failed jobs "+owner+"/"+repo+" run 163419394 ---")
+
+	for _, r := range s.Requests() {
+		assert.True(t, strings.HasPrefix(r, "GET "), "%s changes GitHub", r)
+	}
+	assert.Empty(t, s.Comments(owner, repo, 1641))
+	s.Update(owner, repo, func(*fake.Repository) { assert.Zero(t, master.Attempts) })
+	_, err = os.Stat(progressFile)
+	assert.True(t, os.IsNotExist(err), "the progress is saved")
+
+	// The changes are written as files to the dry run directory, and the runs are reported on again.
+	dryRunDir := filepath.Join(dir, "dry-run")
+	_, err = run(t, s, "./bin/commenter", append(args, "--dry-run-dir="+dryRunDir)...)
+	require.NoError(t, err)
+	files, err := ioutil.ReadDir(dryRunDir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
 	}
+	assert.Contains(t, names, "001-add-labels-"+owner+"-"+repo+"-1641.md")
+	require.Contains(t, names, "002-comment-"+owner+"-"+repo+"-1641.md")
+	report, err := ioutil.ReadFile(filepath.Join(dryRunDir, "002-comment-"+owner+"-"+repo+"-1641.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "This PR **failed 2 out of 2 times**")
+}
+
+func TestCommenterPRSummary(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	s.Update(owner, repo, func(r *fake.Repository) {
+		for _, run := range r.WorkflowRuns {
+			run.UpdatedAt = run.CreatedAt.Add(30 * time.Minute)
+		}
+	})
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	summaryDir := filepath.Join(dir, "summaries")
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "--progress-store=file",
+		"-p=" + filepath.Join(dir, "commenter-progress.yaml"), "--pr-summary", "--pr-summary-dir=" + summaryDir}
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	require.Len(t, s.Comments(owner, repo, 1641), 1)
+
+	// Pull request 1650 is closed too, but fails to be summarized once: only its summary is made again.
+	s.Update(owner, repo, func(r *fake.Repository) {
+		pr := r.PullRequests[0]
+		require.Equal(t, 1641, pr.Number)
+		pr.State, pr.Merged = "closed", true
+		require.Equal(t, 1650, r.PullRequests[1].Number)
+		r.PullRequests[1].State = "closed"
+	})
+	s.FailRequests("GET", "/repos/"+owner+"/"+repo+"/pulls/1650$", http.StatusInternalServerError, 1)
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.Error(t, err)
+	_, err = os.Stat(filepath.Join(summaryDir, owner+"-"+repo+"-1650-"+testSuite+".yaml"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(summaryDir, owner+"-"+repo+"-1650-"+testSuite+".yaml"))
+	assert.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 2)
+	assert.Contains(t, comments[1].Body, "### Flake summary of "+testSuite)
+	assert.Contains(t, comments[1].Body, "This pull request was merged after 2 runs, 2 of which failed, spending an"+
+		" estimated 60 minutes of CI on failed runs.")
+	assert.Contains(t, comments[1].Body, "| Subscription creation manual approval | 2 |\n")
+	assert.Len(t, s.Comments(owner, repo, 1650), 1)
 
+	summary, err := ioutil.ReadFile(filepath.Join(summaryDir, owner+"-"+repo+"-1641-"+testSuite+".yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "merged: true\n")
+	assert.Contains(t, string(summary), "failedruns: 2\n")
+	assert.Contains(t, string(summary), "wastedminutes: 60\n")
+	saved, err := ioutil.ReadFile(filepath.Join(dir, "pr-summaries", owner+"-"+repo+"-1641-"+testSuite+".yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, summary, saved, "the summary is saved with the progress")
+
+	// Pull requests are summarized once.
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1641), 2)
+	assert.Len(t, s.Comments(owner, repo, 1650), 1)
+}
+
+func TestCommenterQuietPolicy(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	head := "1af968cb786e652f76cc0d9e5dd7d079bea984cb"
+	s.AddWorkflowRun(owner, repo, 163419394, head, "failure")
+	draft := s.AddPullRequest(owner, repo, 1700, head)
+	var optOut *fake.PullRequest
+	s.Update(owner, repo, func(r *fake.Repository) {
+		draft.Draft = true
+		optOut = r.PullRequests[0]
+		require.Equal(t, 1641, optOut.Number)
+		optOut.Labels = []string{"no-flake-bot"}
+	})
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	args := []string{"-m=" + owner, "-l=" + commenterRepo, "-f=" + testSuite, "--progress-store=file",
+		"-p=" + filepath.Join(dir, "commenter-progress.yaml"), "--skip-drafts", "--wait-for-runs",
+		"--max-prs-per-run=1"}
+	output, err := run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "it is labeled no-flake-bot")
+	assert.Contains(t, string(output), "it is a draft")
+	assert.Empty(t, s.Comments(owner, repo, 1641))
+	assert.Empty(t, s.Comments(owner, repo, 1700))
+
+	// Only one of the pull requests is reported on per poll.
+	s.Update(owner, repo, func(*fake.Repository) { optOut.Labels, draft.Draft = nil, false })
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+	assert.Empty(t, s.Comments(owner, repo, 1700))
+
+	// The report waits for all runs on the head commit.
+	pending := s.AddWorkflowRun(owner, repo, 163419395, head, "")
+	s.Update(owner, repo, func(*fake.Repository) { pending.Status = "in_progress" })
+	output, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "1 run on its head "+head+" did not complete yet")
+	assert.Empty(t, s.Comments(owner, repo, 1700))
+
+	s.Update(owner, repo, func(*fake.Repository) { pending.Status, pending.Conclusion = "completed", "success" })
+	_, err = run(t, s, "./bin/commenter", args...)
+	require.NoError(t, err)
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+	assert.Len(t, s.Comments(owner, repo, 1700), 1)
+}
+
+func TestCommenterRepoConfig(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	s.AddFile(owner, repo, "master", ".github/flake-analyzer.yaml", []byte(`suites:
+  - name: e2e
+    artifacts: e2e-test-output
+ignore:
+  - test: "Subscription creation manual approval"
+    reason: "Muted in #1641"
+owners:
+  - tests: "."
+    users: ["@olm-maintainers"]
+comment:
+  template: compact
+`))
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = run(t, s, "./bin/commenter", "-m="+owner, "-l="+commenterRepo, "--progress-store=file",
+		"-p="+filepath.Join(dir, "commenter-progress.yaml"))
+	require.NoError(t, err)
+
+	comments := s.Comments(owner, repo, 1641)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Body, "<!-- flake-analyzer report: e2e-test-output -->")
+	assert.Contains(t, comments[0].Body, "| Test | Failures | Commits |")
+	assert.NotContains(t, comments[0].Body, "Subscription creation manual approval")
+	assert.Contains(t, comments[0].Body, "cc @olm-maintainers")
+
+	// Misspelled settings are rejected instead of silently ignored.
+	s.AddFile(owner, repo, "master", ".github/flake-analyzer.yaml", []byte("comments:\n  template: compact\n"))
+	output, err := run(t, s, "./bin/commenter", "-m="+owner, "-l="+commenterRepo, "--progress-store=file",
+		"-p="+filepath.Join(dir, "commenter-progress.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, string(output), "invalid .github/flake-analyzer.yaml")
+}
+
+func TestCommenterReposConfig(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	// Pull request 7 of another repository failed like pull request 1641, the pull requests of a third repository
+	// cannot be listed.
+	sha := "2dee293e111779104380644c57c2bfe0cca79b98"
+	data, err := ioutil.ReadFile(filepath.Join(zipDir, "e2e-test-output-"+sha+"-163340205.zip"))
+	require.NoError(t, err)
+	s.AddArtifact(owner, "other", "unit-"+sha+"-170000002", time.Now(), data)
+	s.AddWorkflowRun(owner, "other", 170000002, sha, "failure")
+	s.AddPullRequest(owner, "other", 7, sha)
+	s.FailRequests("GET", "/repos/"+owner+"/missing/pulls", http.StatusNotFound, -1)
+
+	dir, err := ioutil.TempDir("", "e2e-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "repos.yaml")
+	require.NoError(t, ioutil.WriteFile(config, []byte(fmt.Sprintf(`repos:
+  - owner: %[1]s
+    repo: %[2]s
+    suites: [%[3]s]
+  - owner: %[1]s
+    repo: other
+    suites: [unit]
+    token_env: OTHER_TOKEN
+  - owner: %[1]s
+    repo: missing
+`, owner, repo, testSuite)), 0644))
+
+	cmd := exec.Command("./bin/commenter", "--github-url="+s.URL, "-m="+owner, "-l="+commenterRepo,
+		"--progress-store=file", "-p="+filepath.Join(dir, "commenter-progress.yaml"), "--repos-config="+config)
+	cmd.Env = append(os.Environ(), "GITHUB_TOKEN=e2e-token", "OTHER_TOKEN=other-token")
+	output, err := cmd.CombinedOutput()
+	t.Log(string(output))
+	require.Error(t, err)
+
+	assert.Len(t, s.Comments(owner, repo, 1641), 1)
+	comments := s.Comments(owner, "other", 7)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Body, "<!-- flake-analyzer report: unit -->")
+	assert.Contains(t, string(output), owner+"/"+repo+": 1 test suites, 2 open pull requests, 2 reported on, 1 comments posted")
+	assert.Contains(t, string(output), owner+"/other: 1 test suites, 1 open pull requests, 1 reported on, 1 comments posted")
+	assert.Contains(t, string(output), owner+"/missing: failed")
+
+	// The runs of each repository are looked up with its own token, once per commit.
+	requests, tokens := s.Requests(), s.Tokens()
+	runLookups := 0
+	for i, r := range requests {
+		if strings.Contains(r, "/repos/"+owner+"/other/") {
+			assert.Equal(t, "other-token", tokens[i], r)
+		}
+		if strings.HasPrefix(r, "GET /repos/"+owner+"/other/actions/runs") {
+			assert.Equal(t, "GET /repos/"+owner+"/other/actions/runs", r)
+			runLookups++
+		}
+	}
+	assert.Equal(t, 1, runLookups)
 }